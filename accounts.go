@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+const purgeDeletedUsersInterval = time.Hour
+
+var (
+	errAccountSuspended = errors.New("account suspended")
+	errAccountDeleted   = errors.New("account is pending deletion")
+)
+
+// accountStatusError returns the reason the user may not log in or post, or
+// nil when the account is active.
+func accountStatusError(user database.User) error {
+	if user.SuspendedAt.Valid {
+		return errAccountSuspended
+	}
+	if user.DeletedAt.Valid {
+		return errAccountDeleted
+	}
+	return nil
+}
+
+// requireActiveAccount loads the user and writes an error response, returning
+// false, when their account is suspended or pending deletion.
+func (cfg *apiConfig) requireActiveAccount(writer http.ResponseWriter, req *http.Request, userID uuid.UUID) (database.User, bool) {
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+			return database.User{}, false
+		}
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return database.User{}, false
+	}
+	if err := accountStatusError(user); err != nil {
+		writeCodedErrorResponse(writer, req, http.StatusForbidden, codeAccountUnavailable, errorDetail(err))
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) handlerAdminSuspendUser(writer http.ResponseWriter, req *http.Request) {
+	cfg.setUserSuspended(writer, req, true)
+}
+
+func (cfg *apiConfig) handlerAdminUnsuspendUser(writer http.ResponseWriter, req *http.Request) {
+	cfg.setUserSuspended(writer, req, false)
+}
+
+func (cfg *apiConfig) setUserSuspended(writer http.ResponseWriter, req *http.Request, suspended bool) {
+	adminID := userFromContext(req.Context()).ID
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if userID == adminID {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Cannot target yourself")
+		return
+	}
+	target, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	// Staff can only act on users below their own role.
+	if roleRanks[target.Role] >= roleRanks[userFromContext(req.Context()).Role] {
+		writeErrorResponse(writer, req, http.StatusForbidden, "Forbidden")
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	action := moderationActionSuspendUser
+	if suspended {
+		err = qtx.SuspendUser(req.Context(), userID)
+		if err == nil {
+			err = revokeAllTokens(req.Context(), qtx, userID)
+		}
+	} else {
+		action = moderationActionUnsuspendUser
+		err = qtx.UnsuspendUser(req.Context(), userID)
+	}
+	if err != nil {
+		log.Printf("Error updating suspension: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if _, err := qtx.CreateModerationAction(req.Context(), database.CreateModerationActionParams{
+		AdminID: uuid.NullUUID{UUID: adminID, Valid: true},
+		Action:  action,
+		UserID:  uuid.NullUUID{UUID: userID, Valid: true},
+	}); err != nil {
+		log.Printf("Error recording moderation action: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// AccountDeletion tells a user whose account is pending deletion when it will
+// be purged.
+type AccountDeletion struct {
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type deleteUserRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (cfg *apiConfig) handlerDeleteUser(writer http.ResponseWriter, req *http.Request) {
+	var requestData deleteUserRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	// The password check counts toward the login lockout, so a stolen
+	// access token cannot be used to guess the password here.
+	accountKey := accountLoginKey(user.Email)
+	if !cfg.checkLoginLockout(writer, req, accountKey) {
+		return
+	}
+	if _, err := cfg.passwordHasher.Verify(requestData.Password, user.HashedPassword); err != nil {
+		cfg.rejectLogin(writer, req, accountKey, "Incorrect password")
+		return
+	}
+	cfg.clearLoginFailures(req.Context(), accountKey)
+	if cfg.deletionGracePeriod == 0 {
+		if err := cfg.db.DeleteUser(req.Context(), userID); err != nil {
+			log.Printf("Error deleting user: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	if err := qtx.MarkUserDeleted(req.Context(), userID); err != nil {
+		log.Printf("Error marking user as deleted: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := revokeAllTokens(req.Context(), qtx, userID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusAccepted, AccountDeletion{
+		PurgeAt: time.Now().Add(cfg.deletionGracePeriod),
+	})
+}
+
+type restoreUserRequest struct {
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required"`
+}
+
+func (cfg *apiConfig) handlerRestoreUser(writer http.ResponseWriter, req *http.Request) {
+	var requestData restoreUserRequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	accountKey := accountLoginKey(requestData.Email)
+	if !cfg.checkLoginLockout(writer, req, accountKey) {
+		return
+	}
+	user, err := cfg.db.GetUserByEmail(req.Context(), requestData.Email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		cfg.passwordHasher.Verify(requestData.Password, cfg.dummyPasswordHash)
+		cfg.rejectLogin(writer, req, accountKey, loginFailedMessage)
+		return
+	}
+	if _, err := cfg.passwordHasher.Verify(requestData.Password, user.HashedPassword); err != nil {
+		cfg.rejectLogin(writer, req, accountKey, loginFailedMessage)
+		return
+	}
+	if !user.DeletedAt.Valid {
+		writeErrorResponse(writer, req, http.StatusConflict, "Account is not pending deletion")
+		return
+	}
+	if time.Now().After(user.DeletedAt.Time.Add(cfg.deletionGracePeriod)) {
+		writeErrorResponse(writer, req, http.StatusGone, "Grace period has ended")
+		return
+	}
+	if err := cfg.db.RestoreUser(req.Context(), user.ID); err != nil {
+		log.Printf("Error restoring user: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := userFromDB(user)
+	result.UpdatedAt = time.Now().UTC()
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// purgeDeletedUsers permanently removes accounts whose deletion grace period
+// has ended. Their data is removed by the ON DELETE CASCADE foreign keys.
+func (cfg *apiConfig) purgeDeletedUsers(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-cfg.deletionGracePeriod)
+		purged, err := cfg.db.PurgeDeletedUsers(context.Background(), sql.NullTime{Time: cutoff, Valid: true})
+		if err != nil {
+			log.Printf("Error purging deleted users: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted users", purged)
+		}
+	}
+}
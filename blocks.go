@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+type RelatedUser struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerBlockUser(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	targetID, ok := cfg.targetUserID(writer, req, userID)
+	if !ok {
+		return
+	}
+	if err := cfg.db.CreateBlock(req.Context(), database.CreateBlockParams{BlockerID: userID, BlockedID: targetID}); err != nil {
+		log.Printf("Error creating block: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	targetID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if err := cfg.db.DeleteBlock(req.Context(), database.DeleteBlockParams{BlockerID: userID, BlockedID: targetID}); err != nil {
+		log.Printf("Error deleting block: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerMuteUser(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	targetID, ok := cfg.targetUserID(writer, req, userID)
+	if !ok {
+		return
+	}
+	if err := cfg.db.CreateMute(req.Context(), database.CreateMuteParams{MuterID: userID, MutedID: targetID}); err != nil {
+		log.Printf("Error creating mute: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	targetID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if err := cfg.db.DeleteMute(req.Context(), database.DeleteMuteParams{MuterID: userID, MutedID: targetID}); err != nil {
+		log.Printf("Error deleting mute: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerBlocks(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	blocks, err := cfg.db.GetBlocksByBlocker(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting blocks from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []RelatedUser{}
+	for _, block := range blocks {
+		result = append(result, RelatedUser{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerMutes(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	mutes, err := cfg.db.GetMutesByMuter(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting mutes from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []RelatedUser{}
+	for _, mute := range mutes {
+		result = append(result, RelatedUser{UserID: mute.MutedID, CreatedAt: mute.CreatedAt})
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// targetUserID parses the {userID} path value and writes an error response
+// when it is invalid, refers to the caller or to a user that does not exist.
+func (cfg *apiConfig) targetUserID(writer http.ResponseWriter, req *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	targetID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return uuid.UUID{}, false
+	}
+	if targetID == userID {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Cannot target yourself")
+		return uuid.UUID{}, false
+	}
+	if _, err := cfg.db.GetUserByID(req.Context(), targetID); err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+			return uuid.UUID{}, false
+		}
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return uuid.UUID{}, false
+	}
+	return targetID, true
+}
+
+// hiddenAuthorIDs returns the set of authors the viewer has blocked or muted,
+// and those who blocked the viewer.
+func (cfg *apiConfig) hiddenAuthorIDs(req *http.Request, viewerID uuid.UUID) (map[uuid.UUID]struct{}, error) {
+	ids, err := cfg.db.GetHiddenAuthorIDs(req.Context(), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		hidden[id] = struct{}{}
+	}
+	return hidden, nil
+}
+
+// isBlockedBetween reports whether either user has blocked the other.
+func (cfg *apiConfig) isBlockedBetween(req *http.Request, a, b uuid.UUID) (bool, error) {
+	return cfg.db.IsBlockedBetween(req.Context(), database.IsBlockedBetweenParams{BlockerID: a, BlockedID: b})
+}
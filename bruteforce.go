@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/lockout"
+)
+
+const (
+	loginFailedMessage     = "Incorrect email or password"
+	loginLockedMessage     = "Too many failed attempts. Try again later."
+	loginFailureCleanupAge = 24 * time.Hour
+	loginFailureCleanup    = time.Hour
+)
+
+// Failures are tracked per email address rather than per user row, so that
+// unknown addresses are locked out exactly like real ones.
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (cfg *apiConfig) clientLoginKey(req *http.Request) string {
+	return "ip:" + cfg.clientIP(req)
+}
+
+// checkLoginLockout writes a 429 response and returns false if the account or
+// the client is currently locked out.
+func (cfg *apiConfig) checkLoginLockout(writer http.ResponseWriter, req *http.Request, accountKey string) bool {
+	now := time.Now().UTC()
+	for _, key := range []string{accountKey, cfg.clientLoginKey(req)} {
+		failure, err := cfg.db.GetLoginFailure(req.Context(), key)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Error getting login failures: %s", err)
+			}
+			continue
+		}
+		if failure.LockedUntil.Valid && failure.LockedUntil.Time.After(now) {
+			retryAfter := int(math.Ceil(failure.LockedUntil.Time.Sub(now).Seconds()))
+			writer.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+			writeCodedErrorResponse(writer, req, http.StatusTooManyRequests, codeLoginLocked, loginLockedMessage)
+			return false
+		}
+	}
+	return true
+}
+
+// rejectLogin records a failed attempt against the account and the client,
+// holds the response for the progressive delay and then answers 401.
+func (cfg *apiConfig) rejectLogin(writer http.ResponseWriter, req *http.Request, accountKey, message string) {
+	failures := cfg.recordLoginFailure(req.Context(), accountKey, lockout.Account)
+	cfg.recordLoginFailure(req.Context(), cfg.clientLoginKey(req), lockout.Client)
+	select {
+	case <-time.After(lockout.Account.Delay(failures)):
+	case <-req.Context().Done():
+	}
+	writeErrorResponse(writer, req, http.StatusUnauthorized, message)
+}
+
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, key string, policy lockout.Policy) int {
+	now := time.Now().UTC()
+	failure, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		WindowStart: now.Add(-policy.Window),
+	})
+	if err != nil {
+		log.Printf("Error recording login failure: %s", err)
+		return 0
+	}
+	failures := int(failure.Failures)
+	if duration := policy.LockoutFor(failures); duration > 0 {
+		if err := cfg.db.LockLogin(ctx, database.LockLoginParams{
+			LockedUntil: sql.NullTime{Time: now.Add(duration), Valid: true},
+			Key:         key,
+		}); err != nil {
+			log.Printf("Error locking login: %s", err)
+		}
+	}
+	return failures
+}
+
+// clearLoginFailures resets the account's failure count after a successful
+// login. The client's count is left alone so that one valid account cannot be
+// used to reset an IP that is guessing passwords for others.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, accountKey string) {
+	if err := cfg.db.ClearLoginFailures(ctx, accountKey); err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+}
+
+func (cfg *apiConfig) handlerAdminUnlockUser(writer http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := cfg.db.ClearLoginFailures(req.Context(), accountLoginKey(user.Email)); err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) cleanupLoginFailures(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := cfg.db.DeleteStaleLoginFailures(context.Background(), time.Now().UTC().Add(-loginFailureCleanupAge)); err != nil {
+			log.Printf("Error deleting stale login failures: %s", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// The calls in this file need a moderator, or an admin where noted.
+
+// SetUserRole changes a user's role. It needs an admin.
+func (c *Client) SetUserRole(ctx context.Context, userID uuid.UUID, role string) (*User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method:     http.MethodPut,
+		path:       "/admin/users/" + userID.String() + "/role",
+		body:       map[string]string{"role": role},
+		credential: accessCredential,
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) SuspendUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/admin/users/" + userID.String() + "/suspend", credential: accessCredential}, nil)
+}
+
+func (c *Client) UnsuspendUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/admin/users/" + userID.String() + "/unsuspend", credential: accessCredential}, nil)
+}
+
+// UnlockUser clears a user's failed login attempts.
+func (c *Client) UnlockUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/admin/users/" + userID.String() + "/unlock", credential: accessCredential}, nil)
+}
+
+// ListReportsOptions filters ListReports. Empty fields match every report.
+type ListReportsOptions struct {
+	Status         string
+	Reason         string
+	ReportedUserID uuid.UUID
+}
+
+func (c *Client) ListReports(ctx context.Context, options ListReportsOptions) ([]Report, error) {
+	query := url.Values{}
+	if options.Status != "" {
+		query.Set("status", options.Status)
+	}
+	if options.Reason != "" {
+		query.Set("reason", options.Reason)
+	}
+	if options.ReportedUserID != uuid.Nil {
+		query.Set("reported_user_id", options.ReportedUserID.String())
+	}
+	var reports []Report
+	err := c.do(ctx, request{method: http.MethodGet, path: "/admin/reports", query: query, credential: accessCredential}, &reports)
+	return reports, err
+}
+
+// GetReport returns a report with the moderation actions taken on it.
+func (c *Client) GetReport(ctx context.Context, reportID uuid.UUID) (*Report, error) {
+	var report Report
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/admin/reports/" + reportID.String(), credential: accessCredential}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ResolveReportRequest resolves a report as "actioned" or "dismissed".
+// Actions are moderation actions to take, such as "hide_chirp" or
+// "suspend_user".
+type ResolveReportRequest struct {
+	Status  string   `json:"status"`
+	Note    string   `json:"note,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+func (c *Client) ResolveReport(ctx context.Context, reportID uuid.UUID, params ResolveReportRequest) (*Report, error) {
+	var report Report
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/admin/reports/" + reportID.String() + "/resolve", body: params, credential: accessCredential}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login logs in with an email and password and stores the tokens it returns.
+// Accounts with two-factor authentication get an *MFARequiredError instead.
+func (c *Client) Login(ctx context.Context, email, password string) (*User, error) {
+	var result struct {
+		User
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/login",
+		body:   map[string]string{"email": email, "password": password},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.MFARequired {
+		return nil, &MFARequiredError{MFAToken: result.MFAToken}
+	}
+	c.SetTokens(Tokens{AccessToken: result.Token, RefreshToken: result.RefreshToken})
+	return &result.User, nil
+}
+
+// LoginMFARequest finishes a login with either a TOTP code or a recovery
+// code.
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// LoginMFA finishes a login that returned an *MFARequiredError and stores the
+// tokens it returns.
+func (c *Client) LoginMFA(ctx context.Context, params LoginMFARequest) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/login/mfa", body: params}, &user); err != nil {
+		return nil, err
+	}
+	c.SetTokens(Tokens{AccessToken: user.Token, RefreshToken: user.RefreshToken})
+	return &user, nil
+}
+
+var errNoRefreshToken = errors.New("chirpy: no refresh token")
+
+// Refresh gets a new access token with the refresh token, stores it and
+// returns it. Requests call it on their own when the access token expires.
+func (c *Client) Refresh(ctx context.Context) (string, error) {
+	if c.Tokens().RefreshToken == "" {
+		return "", errNoRefreshToken
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/refresh", credential: refreshCredential}, &result); err != nil {
+		return "", err
+	}
+	c.setAccessToken(result.Token)
+	return result.Token, nil
+}
+
+// Revoke revokes the refresh token, logging this client out, and forgets
+// both tokens.
+func (c *Client) Revoke(ctx context.Context) error {
+	if c.Tokens().RefreshToken == "" {
+		return errNoRefreshToken
+	}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/revoke", credential: refreshCredential}, nil); err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{})
+	return nil
+}
+
+// ForgotPassword emails a password reset token to the account with email, if
+// there is one.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/password/forgot",
+		body:   map[string]string{"email": email},
+	}, nil)
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. Every
+// session of the account is logged out.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/password/reset",
+		body:   map[string]string{"token": token, "password": password},
+	}, nil)
+}
+
+func (c *Client) ListSessions(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/sessions", credential: accessCredential}, &sessions)
+	return sessions, err
+}
+
+func (c *Client) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/sessions/" + sessionID.String(), credential: accessCredential}, nil)
+}
+
+func (c *Client) RevokeAllSessions(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/sessions/revoke-all", credential: accessCredential}, nil)
+}
+
+// EnrollTOTP starts enrolling an authenticator app. Two-factor login is only
+// turned on once ConfirmTOTP succeeds.
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/users/me/2fa", credential: accessCredential}, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// ConfirmTOTP turns on two-factor login with a code from the authenticator
+// and returns the account's recovery codes. Every other session is logged out;
+// this client stores the new tokens it is given.
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	var result struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+		Token         string   `json:"token"`
+		RefreshToken  string   `json:"refresh_token"`
+	}
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/api/users/me/2fa/confirm",
+		body:       map[string]string{"code": code},
+		credential: accessCredential,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	c.SetTokens(Tokens{AccessToken: result.Token, RefreshToken: result.RefreshToken})
+	return result.RecoveryCodes, nil
+}
+
+// Reauthentication proves the caller is the account owner for changes to
+// two-factor login. It needs the password and either a code or a recovery
+// code.
+type Reauthentication struct {
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// DisableTOTP turns off two-factor login. Every other session is logged out;
+// this client stores the new tokens it is given.
+func (c *Client) DisableTOTP(ctx context.Context, params Reauthentication) error {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodDelete, path: "/api/users/me/2fa", body: params, credential: accessCredential}, &user); err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{AccessToken: user.Token, RefreshToken: user.RefreshToken})
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the account's recovery codes.
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context, params Reauthentication) ([]string, error) {
+	var result struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/api/users/me/2fa/recovery-codes",
+		body:       params,
+		credential: accessCredential,
+	}, &result)
+	return result.RecoveryCodes, err
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatePersonalAccessToken creates a token that can be used as the access
+// token of another Client. Its Token is only returned here.
+func (c *Client) CreatePersonalAccessToken(ctx context.Context, params CreatePersonalAccessTokenRequest) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/tokens", body: params, credential: accessCredential}, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (c *Client) ListPersonalAccessTokens(ctx context.Context) ([]PersonalAccessToken, error) {
+	var tokens []PersonalAccessToken
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/tokens", credential: accessCredential}, &tokens)
+	return tokens, err
+}
+
+func (c *Client) DeletePersonalAccessToken(ctx context.Context, tokenID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/tokens/" + tokenID.String(), credential: accessCredential}, nil)
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Confidential bool     `json:"confidential"`
+}
+
+// CreateOAuthClient registers a third-party application. The secret of a
+// confidential client is only returned here.
+func (c *Client) CreateOAuthClient(ctx context.Context, params CreateOAuthClientRequest) (*OAuthClient, error) {
+	var client OAuthClient
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/oauth/clients", body: params, credential: accessCredential}, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (c *Client) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	var clients []OAuthClient
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/oauth/clients", credential: accessCredential}, &clients)
+	return clients, err
+}
+
+// DeleteOAuthClient deletes a client and revokes every token issued to it.
+func (c *Client) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/oauth/clients/" + url.PathEscape(clientID), credential: accessCredential}, nil)
+}
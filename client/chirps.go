@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ListChirpsOptions filters and orders ListChirps. The zero value lists
+// every chirp, oldest first.
+type ListChirpsOptions struct {
+	AuthorID uuid.UUID
+	// Sort is "asc" or "desc" by creation time.
+	Sort string
+}
+
+// ListChirps lists published chirps. When the client is logged in, chirps by
+// users the caller blocked or muted are left out.
+func (c *Client) ListChirps(ctx context.Context, options ListChirpsOptions) ([]Chirp, error) {
+	query := url.Values{}
+	if options.AuthorID != uuid.Nil {
+		query.Set("author_id", options.AuthorID.String())
+	}
+	if options.Sort != "" {
+		query.Set("sort", options.Sort)
+	}
+	credential := noCredential
+	if c.Tokens().AccessToken != "" {
+		credential = accessCredential
+	}
+	var chirps []Chirp
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/chirps", query: query, credential: credential}, &chirps)
+	return chirps, err
+}
+
+func (c *Client) GetChirp(ctx context.Context, chirpID uuid.UUID) (*Chirp, error) {
+	var chirp Chirp
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/chirps/" + chirpID.String()}, &chirp); err != nil {
+		return nil, err
+	}
+	return &chirp, nil
+}
+
+// ListScheduledChirps lists the caller's chirps that are not published yet.
+func (c *Client) ListScheduledChirps(ctx context.Context) ([]Chirp, error) {
+	var chirps []Chirp
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/chirps/scheduled", credential: accessCredential}, &chirps)
+	return chirps, err
+}
+
+// CreateChirpRequest is a new chirp. A future PublishAt schedules it.
+type CreateChirpRequest struct {
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+func (c *Client) CreateChirp(ctx context.Context, params CreateChirpRequest) (*Chirp, error) {
+	var chirp Chirp
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/chirps", body: params, credential: accessCredential}, &chirp); err != nil {
+		return nil, err
+	}
+	return &chirp, nil
+}
+
+func (c *Client) UpdateChirp(ctx context.Context, chirpID uuid.UUID, body string) (*Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, request{
+		method:     http.MethodPut,
+		path:       "/api/chirps/" + chirpID.String(),
+		body:       map[string]string{"body": body},
+		credential: accessCredential,
+	}, &chirp)
+	if err != nil {
+		return nil, err
+	}
+	return &chirp, nil
+}
+
+func (c *Client) DeleteChirp(ctx context.Context, chirpID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/chirps/" + chirpID.String(), credential: accessCredential}, nil)
+}
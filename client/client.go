@@ -0,0 +1,190 @@
+// Package client is a typed client for the Chirpy API. Its methods follow
+// the operations in the OpenAPI document the server publishes at
+// /api/openapi.json.
+//
+// A Client keeps the caller's tokens. Login and LoginMFA store them, and when
+// the server rejects an access token the client gets a new one with the
+// refresh token and retries the request once.
+//
+// The OAuth authorization and token endpoints, single sign-on and the Polka
+// webhook receiver are used by browsers, third-party apps and Polka rather
+// than by services, and are not wrapped.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Tokens are the credentials a Client sends. AccessToken may also be a
+// personal access token, in which case RefreshToken is empty.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	tokens Tokens
+	// refreshMu makes concurrent requests that find the access token expired
+	// share one refresh.
+	refreshMu sync.Mutex
+}
+
+// New returns a client for the server at baseURL, such as
+// "https://chirpy.example.com". A nil httpClient means http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+// Tokens returns the client's current tokens, for callers that keep them
+// between runs.
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the client's tokens.
+func (c *Client) SetTokens(tokens Tokens) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = tokens
+}
+
+func (c *Client) setAccessToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens.AccessToken = token
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context that sends key as the Idempotency-Key
+// of the request it is used for. Retrying CreateUser, CreateChirp or
+// SendMessage with the same key returns the first response instead of
+// repeating the request.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// credential is the token a request is authenticated with.
+type credential int
+
+const (
+	noCredential credential = iota
+	accessCredential
+	refreshCredential
+)
+
+type request struct {
+	method     string
+	path       string
+	query      url.Values
+	body       any
+	credential credential
+}
+
+// do sends r and decodes the response into out, which may be nil. A request
+// whose access token is rejected is retried once after a refresh.
+func (c *Client) do(ctx context.Context, r request, out any) error {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return err
+		}
+	}
+	token := c.token(r.credential)
+	resp, err := c.send(ctx, r, body, token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.credential == accessCredential && c.Tokens().RefreshToken != "" {
+		resp.Body.Close()
+		if token, err = c.refreshAfterRejection(ctx, token); err != nil {
+			return err
+		}
+		if resp, err = c.send(ctx, r, body, token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+func (c *Client) token(cred credential) string {
+	tokens := c.Tokens()
+	switch cred {
+	case accessCredential:
+		return tokens.AccessToken
+	case refreshCredential:
+		return tokens.RefreshToken
+	}
+	return ""
+}
+
+func (c *Client) send(ctx context.Context, r request, body []byte, token string) (*http.Response, error) {
+	target := c.baseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if key, ok := ctx.Value(idempotencyKeyContextKey{}).(string); ok && key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return c.httpClient.Do(req)
+}
+
+// refreshAfterRejection returns an access token to retry with after rejected
+// was refused. Only one refresh runs at a time; requests that were waiting
+// for it use its token.
+func (c *Client) refreshAfterRejection(ctx context.Context, rejected string) (string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if current := c.Tokens().AccessToken; current != rejected {
+		return current, nil
+	}
+	return c.Refresh(ctx)
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errorFromResponse(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Healthz reports whether the server is up.
+func (c *Client) Healthz(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodGet, path: "/api/healthz"}, nil)
+}
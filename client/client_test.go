@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRefreshesRejectedAccessToken(t *testing.T) {
+	var refreshes atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer refresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		refreshes.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{"token": "fresh"})
+	})
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL, nil)
+	c.SetTokens(Tokens{AccessToken: "expired", RefreshToken: "refresh"})
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ListSessions(context.Background()); err != nil {
+				t.Errorf("ListSessions() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := refreshes.Load(); got != 1 {
+		t.Errorf("refreshes = %d, want 1", got)
+	}
+	if got := c.Tokens(); got.AccessToken != "fresh" || got.RefreshToken != "refresh" {
+		t.Errorf("Tokens() = %+v", got)
+	}
+
+	c.SetTokens(Tokens{AccessToken: "expired"})
+	if _, err := c.ListSessions(context.Background()); !IsCode(err, "unauthorized") {
+		t.Errorf("ListSessions() without a refresh token error = %v, want unauthorized", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"type":"/problems/validation_failed","title":"Unprocessable Entity","status":422,"detail":"email must be an email address","instance":"/api/users","code":"validation_failed","errors":[{"field":"email","code":"invalid_email","detail":"email must be an email address"}],"error":"email must be an email address"}`))
+	})
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	})
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"mfa_required":true,"mfa_token":"challenge"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	c := New(server.URL, nil)
+
+	_, err := c.CreateUser(context.Background(), "not an email", "password")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("CreateUser() error = %v, want *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Code != CodeValidationFailed || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "email" {
+		t.Errorf("CreateUser() error = %+v", apiErr)
+	}
+
+	err = c.Healthz(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "bad_gateway" || apiErr.Detail != "upstream unavailable" {
+		t.Errorf("Healthz() error = %+v, want a 502 with the body as detail", err)
+	}
+
+	var mfaErr *MFARequiredError
+	if _, err := c.Login(context.Background(), "user@example.com", "password"); !errors.As(err, &mfaErr) || mfaErr.MFAToken != "challenge" {
+		t.Errorf("Login() error = %v, want an MFA challenge", err)
+	}
+	if c.Tokens() != (Tokens{}) {
+		t.Errorf("Login() stored tokens for an MFA challenge")
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Idempotency-Key")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c := New(server.URL, nil)
+	if _, err := c.CreateChirp(WithIdempotencyKey(context.Background(), "key-1"), CreateChirpRequest{Body: "hello"}); err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	if got != "key-1" {
+		t.Errorf("Idempotency-Key = %q, want key-1", got)
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned by the server. Codes are stable; details are not.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeInsufficientScope    = "insufficient_scope"
+	CodeAccountUnavailable   = "account_unavailable"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeRateLimited          = "rate_limited"
+	CodeLoginLocked          = "login_locked"
+	CodeInternalError        = "internal_error"
+	CodeUpstreamError        = "upstream_error"
+)
+
+// Error is an error response from the server, decoded from its problem
+// details.
+type Error struct {
+	StatusCode int
+	Code       string
+	Title      string
+	Detail     string
+	Instance   string
+	// Fields lists the invalid fields of a rejected request body.
+	Fields []FieldError
+}
+
+// FieldError is one invalid field of a request body, named by its JSON name.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("chirpy: %d %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("chirpy: %d %s: %s", e.StatusCode, e.Code, e.Detail)
+}
+
+// IsCode reports whether err is an Error with the given code.
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// MFARequiredError is returned by Login for accounts with two-factor
+// authentication. Pass MFAToken to LoginMFA with a code to finish logging in.
+type MFARequiredError struct {
+	MFAToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "chirpy: two-factor authentication required"
+}
+
+// errorFromResponse decodes an error response. Responses that are not
+// problem details, such as those from proxies, keep their body as Detail.
+func errorFromResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var problem struct {
+		Title    string       `json:"title"`
+		Detail   string       `json:"detail"`
+		Instance string       `json:"instance"`
+		Code     string       `json:"code"`
+		Errors   []FieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &problem); err == nil && problem.Code != "" {
+		apiErr.Code = problem.Code
+		apiErr.Title = problem.Title
+		apiErr.Detail = problem.Detail
+		apiErr.Instance = problem.Instance
+		apiErr.Fields = problem.Errors
+		return apiErr
+	}
+	apiErr.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(resp.StatusCode)), " ", "_")
+	apiErr.Title = http.StatusText(resp.StatusCode)
+	apiErr.Detail = strings.TrimSpace(string(body))
+	return apiErr
+}
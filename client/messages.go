@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// StartConversation returns the caller's conversation with recipientID,
+// creating it if there is none.
+func (c *Client) StartConversation(ctx context.Context, recipientID uuid.UUID) (*Conversation, error) {
+	var conversation Conversation
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/api/conversations",
+		body:       map[string]string{"recipient_id": recipientID.String()},
+		credential: accessCredential,
+	}, &conversation)
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func (c *Client) ListConversations(ctx context.Context) ([]Conversation, error) {
+	var conversations []Conversation
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/conversations", credential: accessCredential}, &conversations)
+	return conversations, err
+}
+
+func (c *Client) ListMessages(ctx context.Context, conversationID uuid.UUID) ([]Message, error) {
+	var messages []Message
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/conversations/" + conversationID.String() + "/messages", credential: accessCredential}, &messages)
+	return messages, err
+}
+
+func (c *Client) SendMessage(ctx context.Context, conversationID uuid.UUID, body string) (*Message, error) {
+	var message Message
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/api/conversations/" + conversationID.String() + "/messages",
+		body:       map[string]string{"body": body},
+		credential: accessCredential,
+	}, &message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// MarkMessagesRead marks the messages sent to the caller in a conversation as
+// read.
+func (c *Client) MarkMessagesRead(ctx context.Context, conversationID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/conversations/" + conversationID.String() + "/read", credential: accessCredential}, nil)
+}
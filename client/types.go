@@ -0,0 +1,176 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User is an account. Token and RefreshToken are only set by the calls that
+// log in.
+type User struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Role          string    `json:"role"`
+}
+
+// AccountDeletion says when an account that is pending deletion will be
+// purged.
+type AccountDeletion struct {
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+// Session is a login on one device.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// PersonalAccessToken is a long-lived API token. Token is only set when it
+// is created.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// OAuthClient is a registered third-party application. Secret is only set
+// when a confidential client is created.
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+type Subscription struct {
+	Plan               string              `json:"plan"`
+	Status             string              `json:"status"`
+	CurrentPeriodStart time.Time           `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time           `json:"current_period_end"`
+	IsChirpyRed        bool                `json:"is_chirpy_red"`
+	History            []SubscriptionEvent `json:"history"`
+}
+
+type SubscriptionEvent struct {
+	CreatedAt        time.Time `json:"created_at"`
+	Event            string    `json:"event"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+type Conversation struct {
+	ID             uuid.UUID   `json:"id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	ParticipantIDs []uuid.UUID `json:"participant_ids"`
+}
+
+type Message struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+// RelatedUser is a user the caller blocked or muted.
+type RelatedUser struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+type Report struct {
+	ID             uuid.UUID          `json:"id"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	ReporterID     uuid.UUID          `json:"reporter_id"`
+	ChirpID        *uuid.UUID         `json:"chirp_id"`
+	ReportedUserID uuid.UUID          `json:"reported_user_id"`
+	Reason         string             `json:"reason"`
+	Details        string             `json:"details"`
+	Status         string             `json:"status"`
+	ResolvedBy     *uuid.UUID         `json:"resolved_by"`
+	ResolvedAt     *time.Time         `json:"resolved_at"`
+	ResolutionNote string             `json:"resolution_note"`
+	Actions        []ModerationAction `json:"actions,omitempty"`
+}
+
+type ModerationAction struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	AdminID   *uuid.UUID `json:"admin_id"`
+	Action    string     `json:"action"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	UserID    *uuid.UUID `json:"user_id"`
+}
+
+// Webhook is a URL subscribed to events. Secret is only set when it is
+// created.
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Scope     string    `json:"scope"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
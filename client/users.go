@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// CreateUser signs up a new account. It does not log in.
+func (c *Client) CreateUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/users",
+		body:   map[string]string{"email": email, "password": password},
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser changes the caller's email and password. A new email is pending
+// until it is verified. The server ends every session, so the client switches
+// to the new tokens in the response.
+func (c *Client) UpdateUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method:     http.MethodPut,
+		path:       "/api/users",
+		body:       map[string]string{"email": email, "password": password},
+		credential: accessCredential,
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	c.SetTokens(Tokens{AccessToken: user.Token, RefreshToken: user.RefreshToken})
+	return &user, nil
+}
+
+// DeleteUser deletes the caller's account. When the server keeps deleted
+// accounts for a grace period it returns when the account will be purged;
+// otherwise the account is gone and the result is nil.
+func (c *Client) DeleteUser(ctx context.Context, password string) (*AccountDeletion, error) {
+	var deletion *AccountDeletion
+	err := c.do(ctx, request{
+		method:     http.MethodDelete,
+		path:       "/api/users",
+		body:       map[string]string{"password": password},
+		credential: accessCredential,
+	}, &deletion)
+	return deletion, err
+}
+
+// RestoreUser cancels the deletion of an account in its grace period.
+func (c *Client) RestoreUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/users/restore",
+		body:   map[string]string{"email": email, "password": password},
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// VerifyEmail confirms an address with the token emailed to it.
+func (c *Client) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/email/verify",
+		body:   map[string]string{"token": token},
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) ResendEmailVerification(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/email/verify/resend", credential: accessCredential}, nil)
+}
+
+func (c *Client) GetSubscription(ctx context.Context) (*Subscription, error) {
+	var subscription Subscription
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/users/me/subscription", credential: accessCredential}, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (c *Client) BlockUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/users/" + userID.String() + "/block", credential: accessCredential}, nil)
+}
+
+func (c *Client) UnblockUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/users/" + userID.String() + "/block", credential: accessCredential}, nil)
+}
+
+func (c *Client) MuteUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/users/" + userID.String() + "/mute", credential: accessCredential}, nil)
+}
+
+func (c *Client) UnmuteUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/users/" + userID.String() + "/mute", credential: accessCredential}, nil)
+}
+
+func (c *Client) ListBlocks(ctx context.Context) ([]RelatedUser, error) {
+	var users []RelatedUser
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/users/me/blocks", credential: accessCredential}, &users)
+	return users, err
+}
+
+func (c *Client) ListMutes(ctx context.Context) ([]RelatedUser, error) {
+	var users []RelatedUser
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/users/me/mutes", credential: accessCredential}, &users)
+	return users, err
+}
+
+func (c *Client) ListNotifications(ctx context.Context) ([]Notification, error) {
+	var notifications []Notification
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/notifications", credential: accessCredential}, &notifications)
+	return notifications, err
+}
+
+func (c *Client) MarkNotificationsRead(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/api/notifications/read", credential: accessCredential}, nil)
+}
+
+// CreateReportRequest reports either a chirp or a user; set one of ChirpID
+// and UserID.
+type CreateReportRequest struct {
+	ChirpID *uuid.UUID `json:"chirp_id,omitempty"`
+	UserID  *uuid.UUID `json:"user_id,omitempty"`
+	Reason  string     `json:"reason"`
+	Details string     `json:"details,omitempty"`
+}
+
+func (c *Client) CreateReport(ctx context.Context, params CreateReportRequest) (*Report, error) {
+	var report Report
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/reports", body: params, credential: accessCredential}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
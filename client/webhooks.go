@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// CreateWebhookRequest subscribes URL to events. Scope is "user" for the
+// caller's own events, or "global" for admins.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Scope  string   `json:"scope,omitempty"`
+}
+
+// CreateWebhook subscribes a URL to events. The secret deliveries are signed
+// with is only returned here.
+func (c *Client) CreateWebhook(ctx context.Context, params CreateWebhookRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/webhooks", body: params, credential: accessCredential}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/webhooks", credential: accessCredential}, &webhooks)
+	return webhooks, err
+}
+
+func (c *Client) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/webhooks/" + webhookID.String(), credential: accessCredential}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// UpdateWebhookRequest changes the fields that are set.
+type UpdateWebhookRequest struct {
+	URL    *string  `json:"url,omitempty"`
+	Events []string `json:"events,omitempty"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, webhookID uuid.UUID, params UpdateWebhookRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, request{method: http.MethodPut, path: "/api/webhooks/" + webhookID.String(), body: params, credential: accessCredential}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/webhooks/" + webhookID.String(), credential: accessCredential}, nil)
+}
+
+// ListWebhookDeliveries lists a webhook's recent deliveries, newest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/webhooks/" + webhookID.String() + "/deliveries", credential: accessCredential}, &deliveries)
+	return deliveries, err
+}
+
+// RedeliverWebhook queues a delivery to be sent again.
+func (c *Client) RedeliverWebhook(ctx context.Context, webhookID, deliveryID uuid.UUID) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/api/webhooks/" + webhookID.String() + "/deliveries/" + deliveryID.String() + "/redeliver",
+		credential: accessCredential,
+	}, &delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,86 @@
+// Command polka-sim sends signed Polka webhook deliveries to a running
+// Chirpy for local development.
+//
+// Usage:
+//
+//	go run ./cmd/polka-sim -user <user-id> [-event user.upgraded] [-scenario single]
+//
+// Scenarios:
+//
+//	single        deliver the event once, retrying failures
+//	duplicate     deliver the same delivery ID -count times
+//	out-of-order  deliver user.upgraded then -event, in reverse order
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/panaiotuzunov/Chirpy/internal/polkasim"
+)
+
+func main() {
+	godotenv.Load(".env")
+	url := flag.String("url", "http://localhost:8080/api/polka/webhooks", "Chirpy webhook URL")
+	key := flag.String("key", os.Getenv("POLKA_KEY"), "Polka signing key")
+	event := flag.String("event", "user.upgraded", "event name")
+	user := flag.String("user", "", "ID of the user the event is about")
+	plan := flag.String("plan", "", "plan name sent with the event")
+	periodEnd := flag.Duration("period", 0, "period length from now sent as period_end")
+	scenario := flag.String("scenario", "single", "single, duplicate or out-of-order")
+	count := flag.Int("count", 2, "number of deliveries for the duplicate scenario")
+	attempts := flag.Int("attempts", 5, "delivery attempts before giving up")
+	flag.Parse()
+
+	userID, err := uuid.Parse(*user)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-user must be a valid user ID")
+		os.Exit(2)
+	}
+	if *key == "" {
+		fmt.Fprintln(os.Stderr, "-key or POLKA_KEY is required")
+		os.Exit(2)
+	}
+	sim := polkasim.New(*url, *key)
+	sim.MaxAttempts = *attempts
+
+	newDelivery := func(name string) polkasim.Delivery {
+		e := polkasim.Event{Name: name, UserID: userID, Plan: *plan}
+		if *periodEnd > 0 {
+			e.PeriodEnd = time.Now().Add(*periodEnd).UTC()
+		}
+		delivery, err := polkasim.NewDelivery(e)
+		if err != nil {
+			log.Fatalf("Error building delivery - %v", err)
+		}
+		return delivery
+	}
+
+	ctx := context.Background()
+	var statuses []int
+	switch *scenario {
+	case "single":
+		var status int
+		status, err = sim.Deliver(ctx, newDelivery(*event))
+		statuses = append(statuses, status)
+	case "duplicate":
+		statuses, err = sim.DeliverDuplicate(ctx, newDelivery(*event), *count)
+	case "out-of-order":
+		statuses, err = sim.DeliverOutOfOrder(ctx, []polkasim.Delivery{newDelivery("user.upgraded"), newDelivery(*event)})
+	default:
+		fmt.Fprintf(os.Stderr, "unknown scenario %q\n", *scenario)
+		os.Exit(2)
+	}
+	for i, status := range statuses {
+		fmt.Printf("delivery %d: %d\n", i+1, status)
+	}
+	if err != nil {
+		log.Fatalf("Error delivering - %v", err)
+	}
+}
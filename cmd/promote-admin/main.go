@@ -0,0 +1,44 @@
+// Command promote-admin grants the admin role to an existing user. It is
+// used to bootstrap the first admin, who can then manage roles through
+// PUT /admin/users/{userID}/role.
+//
+// Usage:
+//
+//	go run ./cmd/promote-admin <email>
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: promote-admin <email>")
+		os.Exit(2)
+	}
+	godotenv.Load(".env")
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatalf("Error connecting to DB - %v", err)
+	}
+	defer db.Close()
+	user, err := database.New(db).SetUserRoleByEmail(context.Background(), database.SetUserRoleByEmailParams{
+		Role:  "admin",
+		Email: os.Args[1],
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Fatalf("No user with email %q", os.Args[1])
+		}
+		log.Fatalf("Error promoting user - %v", err)
+	}
+	fmt.Printf("User %s (%s) is now an admin\n", user.Email, user.ID)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/validate"
+)
+
+const maxRequestBodyBytes = 1 << 20
+
+var (
+	errUnsupportedMediaType = errors.New("content-type must be application/json")
+	errTrailingData         = errors.New("request body must contain a single JSON value")
+)
+
+// decodeRequest reads a JSON request body into dst and checks the rules in
+// dst's validate tags. On failure it writes the problem and returns false.
+func decodeRequest(w http.ResponseWriter, req *http.Request, dst any) bool {
+	if !decodeJSON(w, req, dst) {
+		return false
+	}
+	if errs := validateRequest(dst); len(errs) > 0 {
+		writeValidationError(w, req, errs...)
+		return false
+	}
+	return true
+}
+
+// decodeJSON reads a JSON request body into dst without validating it, for
+// handlers that add their own checks to validateRequest's. Bodies larger than
+// maxRequestBodyBytes, other content types, unknown fields and trailing data
+// are rejected. On failure it writes the problem and returns false.
+func decodeJSON(w http.ResponseWriter, req *http.Request, dst any) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		writeErrorResponse(w, req, http.StatusUnsupportedMediaType, errorDetail(errUnsupportedMediaType))
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestBodyBytes))
+	if err != nil {
+		writeDecodeError(w, req, err)
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		// encoding/json does not say which field a bad timestamp was in.
+		var parseErr *time.ParseError
+		if errors.As(err, &parseErr) {
+			if field := invalidTimeField(body, dst); field != "" {
+				writeValidationError(w, req, invalidField(field, field+" must be an RFC 3339 date-time"))
+				return false
+			}
+		}
+		writeDecodeError(w, req, err)
+		return false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		writeDecodeError(w, req, errTrailingData)
+		return false
+	}
+	return true
+}
+
+// invalidTimeField returns the JSON name of the first time field of dst whose
+// value in body is not a valid timestamp, or "" if there is none.
+func invalidTimeField(body []byte, dst any) string {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return ""
+	}
+	t := reflect.TypeOf(dst).Elem()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Type != reflect.TypeFor[time.Time]() && field.Type != reflect.TypeFor[*time.Time]() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		value, ok := raw[name]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, new(time.Time)); err != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// decodeQuery reads the query string into dst, a pointer to a struct of
+// string fields named by their json tags, and checks the rules in its
+// validate tags. On failure it writes the problem and returns false.
+func decodeQuery(w http.ResponseWriter, req *http.Request, dst any) bool {
+	query := req.URL.Query()
+	value := reflect.ValueOf(dst).Elem()
+	for i := range value.NumField() {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		value.Field(i).SetString(query.Get(name))
+	}
+	if errs := validateRequest(dst); len(errs) > 0 {
+		writeValidationError(w, req, errs...)
+		return false
+	}
+	return true
+}
+
+// validateRequest returns the fields of dst that break its validate rules.
+func validateRequest(dst any) []fieldError {
+	var errs []fieldError
+	for _, err := range validate.Struct(dst) {
+		errs = append(errs, fieldError(err))
+	}
+	return errs
+}
+
+// writeDecodeError reports a request body that is not the JSON the handler
+// expects. It is the client's mistake, so it is a 400, with the offending
+// field when the problem is limited to one.
+func writeDecodeError(w http.ResponseWriter, req *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeErrorResponse(w, req, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	problem := errorResponse{
+		Status: http.StatusBadRequest,
+		Code:   codeInvalidJSON,
+		Detail: "Request body is not valid JSON",
+	}
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		problem.Errors = []fieldError{{Field: typeErr.Field, Code: "invalid_type", Detail: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type.String()))}}
+		problem.Detail = problem.Errors[0].Detail
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		problem.Errors = []fieldError{{Field: field, Code: "unknown_field", Detail: fmt.Sprintf("%s is not a known field", field)}}
+		problem.Detail = problem.Errors[0].Detail
+	case err == errTrailingData:
+		problem.Detail = "Request body must contain a single JSON value"
+	}
+	writeProblem(w, req, problem)
+}
+
+// jsonTypeName names a Go type the way a JSON client would think of it.
+func jsonTypeName(goType string) string {
+	switch {
+	case goType == "string", goType == "uuid.UUID", goType == "time.Time":
+		return "string"
+	case goType == "bool":
+		return "boolean"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"), strings.HasPrefix(goType, "float"):
+		return "number"
+	case strings.HasPrefix(goType, "[]"):
+		return "array"
+	}
+	return "object"
+}
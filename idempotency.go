@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+const (
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+	idempotencyKeyCleanup    = time.Hour
+	// idempotencyKeyLease is how long a claimed key waits for its request to
+	// finish. After that a retry of the same request takes the claim over,
+	// so a key is not stuck if the server stopped mid-request.
+	idempotencyKeyLease        = time.Minute
+	maxIdempotencyKeyLength    = 255
+	maxIdempotentRequestLength = 1 << 20
+)
+
+// newIdempotencyKeyTTL reads IDEMPOTENCY_KEY_TTL, how long a response is
+// kept for replay.
+func newIdempotencyKeyTTL() (time.Duration, error) {
+	value := os.Getenv("IDEMPOTENCY_KEY_TTL")
+	if value == "" {
+		return defaultIdempotencyKeyTTL, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// middlewareIdempotency makes retries of next safe when the client sends an
+// Idempotency-Key header. The first response for a caller, key, method and
+// path is stored and replayed to later requests with the same key, which are
+// marked with Idempotent-Replayed. Reusing a key with a different body is
+// rejected. Only successes and final client errors are stored; after any
+// other response, or a panic, the key is released so the request can be
+// retried for real. A request that outlives its lease can no longer store
+// or release the key, which a retry may have taken over.
+// Callers are identified by access token, and anonymous callers share one
+// namespace, so keys must be random.
+func (cfg *apiConfig) middlewareIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeErrorResponse(w, r, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestLength))
+		if err != nil {
+			writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		params := database.GetIdempotencyKeyParams{
+			Owner:          "anonymous",
+			IdempotencyKey: key,
+			Route:          r.Method + " " + r.URL.Path,
+		}
+		if userID, err := cfg.authenticatedUserID(r); err == nil {
+			params.Owner = "user:" + userID.String()
+		}
+
+		// Postgres keeps microseconds, and locked_until is compared exactly
+		// to tell this claim from a later one.
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		lockedUntil := now.Add(idempotencyKeyLease)
+		claimed, err := cfg.db.ClaimIdempotencyKey(r.Context(), database.ClaimIdempotencyKeyParams{
+			Owner:          params.Owner,
+			IdempotencyKey: params.IdempotencyKey,
+			Route:          params.Route,
+			RequestHash:    hash,
+			ExpiresAt:      now.Add(cfg.idempotencyKeyTTL),
+			LockedUntil:    lockedUntil,
+		})
+		if err != nil {
+			log.Printf("Error claiming idempotency key: %s", err)
+			writeErrorResponse(w, r, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		if claimed == 0 {
+			cfg.replayIdempotentResponse(w, r, params, hash)
+			return
+		}
+
+		// The request may have been cancelled by now, but the outcome must
+		// still be recorded.
+		ctx := context.WithoutCancel(r.Context())
+		release := func() {
+			if err := cfg.db.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams{
+				Owner:          params.Owner,
+				IdempotencyKey: params.IdempotencyKey,
+				Route:          params.Route,
+				RequestHash:    hash,
+				LockedUntil:    lockedUntil,
+			}); err != nil {
+				log.Printf("Error deleting idempotency key: %s", err)
+			}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if !storableIdempotentStatus(recorder.statusCode) {
+			release()
+			return
+		}
+		if err := cfg.db.SaveIdempotentResponse(ctx, database.SaveIdempotentResponseParams{
+			StatusCode:     sql.NullInt32{Int32: int32(recorder.statusCode), Valid: true},
+			ContentType:    sql.NullString{String: w.Header().Get("Content-Type"), Valid: true},
+			ResponseBody:   recorder.body.Bytes(),
+			Owner:          params.Owner,
+			IdempotencyKey: params.IdempotencyKey,
+			Route:          params.Route,
+			RequestHash:    hash,
+			LockedUntil:    lockedUntil,
+		}); err != nil {
+			log.Printf("Error saving idempotent response: %s", err)
+		}
+	}
+}
+
+// storableIdempotentStatus reports whether a response with statusCode is
+// replayed to retries. Other client errors, such as an expired token or a
+// rate limit, may not happen again.
+func storableIdempotentStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return statusCode >= 200 && statusCode < 300
+}
+
+// replayIdempotentResponse answers a request whose key was already claimed.
+func (cfg *apiConfig) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, params database.GetIdempotencyKeyParams, requestHash string) {
+	stored, err := cfg.db.GetIdempotencyKey(r.Context(), params)
+	if err != nil {
+		log.Printf("Error getting idempotency key: %s", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if stored.RequestHash != requestHash {
+		writeCodedErrorResponse(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+		return
+	}
+	if !stored.StatusCode.Valid {
+		w.Header().Set("Retry-After", "1")
+		writeErrorResponse(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+	if stored.ContentType.String != "" {
+		w.Header().Set("Content-Type", stored.ContentType.String)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(stored.StatusCode.Int32))
+	w.Write(stored.ResponseBody)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (cfg *apiConfig) cleanupIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := cfg.db.DeleteExpiredIdempotencyKeys(context.Background()); err != nil {
+			log.Printf("Error deleting expired idempotency keys: %s", err)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,30 +12,80 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Access tokens and MFA challenge tokens are signed with the same secret, so
+// they are told apart by issuer.
+const (
+	accessTokenIssuer       = "chirpy"
+	mfaChallengeTokenIssuer = "chirpy-mfa"
+)
+
+// tokenClaims adds the user's token version to the registered claims. Bumping
+// the version in the database invalidates every access token issued before.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Version int32 `json:"ver"`
+}
+
+// TokenVersionFunc returns the user's current token version.
+type TokenVersionFunc func(userID uuid.UUID) (int32, error)
+
+var errTokenRevoked = errors.New("token has been revoked")
+
+func MakeJWT(userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(accessTokenIssuer, userID, tokenVersion, tokenSecret, expiresIn)
+}
+
+// ValidateJWT checks the access token's signature, expiry and issuer, then
+// rejects it if currentVersion reports that the user's tokens were revoked
+// after it was issued.
+func ValidateJWT(tokenString, tokenSecret string, currentVersion TokenVersionFunc) (uuid.UUID, error) {
+	claims, err := validateToken(accessTokenIssuer, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	id, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return "", fmt.Errorf("error hashing password")
+		return uuid.UUID{}, fmt.Errorf("could not parse uuid")
+	}
+	version, err := currentVersion(id)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("error getting token version - %w", err)
 	}
-	return string(hash), nil
+	if claims.Version != version {
+		return uuid.UUID{}, errTokenRevoked
+	}
+	return id, nil
 }
 
-func CheckPasswordHash(password, hash string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return fmt.Errorf("invalid password")
+// MakeMFAChallengeToken returns a short-lived token proving that userID has
+// passed the password step of login. It cannot be used as an access token.
+func MakeMFAChallengeToken(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeToken(mfaChallengeTokenIssuer, userID, 0, tokenSecret, expiresIn)
+}
+
+func ValidateMFAChallengeToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := validateToken(mfaChallengeTokenIssuer, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("could not parse uuid")
 	}
-	return nil
+	return id, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
-		Subject:   userID.String(),
+func makeToken(issuer string, userID uuid.UUID, tokenVersion int32, tokenSecret string, expiresIn time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
+			Subject:   userID.String(),
+		},
+		Version: tokenVersion,
 	})
 	signedJWT, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -42,22 +94,18 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return signedJWT, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+func validateToken(issuer, tokenString, tokenSecret string) (tokenClaims, error) {
+	claims := tokenClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithIssuer(issuer))
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("error retrieving token - %w", err)
+		return tokenClaims{}, fmt.Errorf("error retrieving token - %w", err)
 	}
 	if !token.Valid {
-		return uuid.UUID{}, fmt.Errorf("invalid token")
+		return tokenClaims{}, fmt.Errorf("invalid token")
 	}
-	id, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("could not parse uuid")
-	}
-	return id, nil
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -85,18 +133,25 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func GetAPIKey(headers http.Header) (string, error) {
-	header := headers.Get("Authorization")
-	if header == "" {
-		return "", fmt.Errorf("header 'Authorization' not found")
-	}
-	stripedHeader := strings.TrimSpace(header)
-	if !strings.HasPrefix(stripedHeader, "ApiKey") {
-		return "", fmt.Errorf("invalid token scheme")
-	}
-	apiKey := strings.TrimSpace(strings.TrimPrefix(stripedHeader, "ApiKey"))
-	if apiKey == "" {
-		return "", fmt.Errorf("empty token")
+// HashToken returns the hex SHA-256 of a random single-use token so that only
+// the hash needs to be stored. Tokens are high-entropy, so no salt is needed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs in the Authorization header, and found by secret scanners.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
 	}
-	return apiKey, nil
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
 }
@@ -63,8 +63,11 @@ func TestCheckPasswordHash(t *testing.T) {
 }
 
 func TestValidateJWT(t *testing.T) {
-	validToken, _ := MakeJWT(uuid.New(), "key", time.Minute)
-	expiredToken, _ := MakeJWT(uuid.New(), "key", -time.Minute)
+	validToken, _ := MakeJWT(uuid.New(), 2, "key", time.Minute)
+	expiredToken, _ := MakeJWT(uuid.New(), 2, "key", -time.Minute)
+	revokedToken, _ := MakeJWT(uuid.New(), 1, "key", time.Minute)
+	challengeToken, _ := MakeMFAChallengeToken(uuid.New(), "key", time.Minute)
+	currentVersion := func(uuid.UUID) (int32, error) { return 2, nil }
 
 	tests := []struct {
 		name        string
@@ -96,11 +99,23 @@ func TestValidateJWT(t *testing.T) {
 			key:         "key",
 			wantErr:     true,
 		},
+		{
+			name:        "token issued before revocation",
+			tokenString: revokedToken,
+			key:         "key",
+			wantErr:     true,
+		},
+		{
+			name:        "MFA challenge token",
+			tokenString: challengeToken,
+			key:         "key",
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := ValidateJWT(tt.tokenString, tt.key)
+			_, err := ValidateJWT(tt.tokenString, tt.key, currentVersion)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -175,3 +190,134 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	now := time.Now()
+	validHeader := SignWebhook(body, "delivery-1", now, "key")
+
+	tests := []struct {
+		name       string
+		header     string
+		body       []byte
+		deliveryID string
+		keys       []string
+		wantErr    bool
+	}{
+		{
+			name:       "valid signature",
+			header:     validHeader,
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"key"},
+			wantErr:    false,
+		},
+		{
+			name:       "valid signature with rotated keys",
+			header:     validHeader,
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"new-key", "key"},
+			wantErr:    false,
+		},
+		{
+			name:       "wrong key",
+			header:     validHeader,
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"other"},
+			wantErr:    true,
+		},
+		{
+			name:       "tampered body",
+			header:     validHeader,
+			body:       []byte(`{"event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000000"}}`),
+			deliveryID: "delivery-1",
+			keys:       []string{"key"},
+			wantErr:    true,
+		},
+		{
+			name:       "different delivery ID",
+			header:     validHeader,
+			body:       body,
+			deliveryID: "delivery-2",
+			keys:       []string{"key"},
+			wantErr:    true,
+		},
+		{
+			name:       "expired timestamp",
+			header:     SignWebhook(body, "delivery-1", now.Add(-time.Hour), "key"),
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"key"},
+			wantErr:    true,
+		},
+		{
+			name:       "malformed header",
+			header:     "ApiKey key",
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"key"},
+			wantErr:    true,
+		},
+		{
+			name:       "empty header",
+			header:     "",
+			body:       body,
+			deliveryID: "delivery-1",
+			keys:       []string{"key"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.header, tt.body, tt.deliveryID, tt.keys, 5*time.Minute, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWebhookSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, _ := MakeRefreshToken()
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken() returned the token unchanged")
+	}
+	other, _ := MakeRefreshToken()
+	if HashToken(token) == HashToken(other) {
+		t.Errorf("HashToken() returned the same hash for different tokens")
+	}
+}
+
+func TestValidateMFAChallengeToken(t *testing.T) {
+	userID := uuid.New()
+	challengeToken, _ := MakeMFAChallengeToken(userID, "key", time.Minute)
+	accessToken, _ := MakeJWT(userID, 0, "key", time.Minute)
+
+	got, err := ValidateMFAChallengeToken(challengeToken, "key")
+	if err != nil || got != userID {
+		t.Errorf("ValidateMFAChallengeToken() = %v, %v, want %v", got, err, userID)
+	}
+	if _, err := ValidateMFAChallengeToken(accessToken, "key"); err == nil {
+		t.Errorf("ValidateMFAChallengeToken() accepted an access token")
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false", token)
+	}
+	jwt, _ := MakeJWT(uuid.New(), 0, "key", time.Minute)
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("IsPersonalAccessToken() = true for a JWT")
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep the tests fast.
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2Params)
+	stronger := NewPasswordHasher(Argon2Params{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	argonHash, _ := hasher.Hash("correct horse battery")
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	longPassword := strings.Repeat("a", 100)
+	longHash, _ := hasher.Hash(longPassword)
+
+	tests := []struct {
+		name            string
+		hasher          *PasswordHasher
+		password        string
+		hash            string
+		wantErr         bool
+		wantNeedsRehash bool
+	}{
+		{
+			name:     "argon2id with current parameters",
+			hasher:   hasher,
+			password: "correct horse battery",
+			hash:     argonHash,
+		},
+		{
+			name:     "argon2id wrong password",
+			hasher:   hasher,
+			password: "wrong horse battery",
+			hash:     argonHash,
+			wantErr:  true,
+		},
+		{
+			name:            "argon2id with outdated parameters",
+			hasher:          stronger,
+			password:        "correct horse battery",
+			hash:            argonHash,
+			wantNeedsRehash: true,
+		},
+		{
+			name:            "legacy bcrypt",
+			hasher:          hasher,
+			password:        "correct horse battery",
+			hash:            string(bcryptHash),
+			wantNeedsRehash: true,
+		},
+		{
+			name:     "legacy bcrypt wrong password",
+			hasher:   hasher,
+			password: "wrong horse battery",
+			hash:     string(bcryptHash),
+			wantErr:  true,
+		},
+		{
+			name:     "long passwords are not truncated",
+			hasher:   hasher,
+			password: longPassword[:99] + "b",
+			hash:     longHash,
+			wantErr:  true,
+		},
+		{
+			name:     "malformed hash",
+			hasher:   hasher,
+			password: "correct horse battery",
+			hash:     "$argon2id$v=19$m=1024",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.hasher.Verify(tt.password, tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := NewPasswordPolicy(8, 64)
+	policy.AddBreached(strings.NewReader("# extra list\ncorrecthorse\n"))
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		wantErr  error
+	}{
+		{name: "acceptable", password: "correct horse battery", email: "user@example.com"},
+		{name: "too short", password: "short", wantErr: ErrPasswordTooShort},
+		{name: "multibyte characters count once", password: "ключ", wantErr: ErrPasswordTooShort},
+		{name: "too long", password: strings.Repeat("a", 65), wantErr: ErrPasswordTooLong},
+		{name: "whitespace", password: "          ", wantErr: ErrPasswordWhitespace},
+		{name: "embedded list", password: "Password123", wantErr: ErrPasswordBreached},
+		{name: "added list", password: "CorrectHorse", wantErr: ErrPasswordBreached},
+		{name: "email", password: "User@Example.com", email: "user@example.com", wantErr: ErrPasswordIsEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policy.Check(tt.password, tt.email); err != tt.wantErr {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort   = errors.New("password is too short")
+	ErrPasswordTooLong    = errors.New("password is too long")
+	ErrPasswordBreached   = errors.New("password is too common")
+	ErrPasswordIsEmail    = errors.New("password must not be your email address")
+	ErrPasswordWhitespace = errors.New("password must not be only whitespace")
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy is checked when a password is set. Lengths are counted in
+// characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy returns a policy that rejects the embedded list of common
+// passwords.
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	policy := &PasswordPolicy{MinLength: minLength, MaxLength: maxLength, breached: map[string]struct{}{}}
+	policy.AddBreached(strings.NewReader(commonPasswords))
+	return policy
+}
+
+// AddBreached adds passwords read one per line from r to the breached list.
+// Blank lines and lines starting with # are ignored, and matching is case
+// insensitive.
+func (p *PasswordPolicy) AddBreached(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+func (p *PasswordPolicy) Check(password, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if length > p.MaxLength {
+		return ErrPasswordTooLong
+	}
+	if strings.TrimSpace(password) == "" {
+		return ErrPasswordWhitespace
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		return ErrPasswordIsEmail
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
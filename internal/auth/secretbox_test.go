@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("NewSecretBox() error = %v", err)
+	}
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP", []byte("user-1"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("Seal() = %q, want an encrypted value", sealed)
+	}
+	otherKey, _ := NewSecretBox(bytes.Repeat([]byte{2}, 32))
+
+	tests := []struct {
+		name           string
+		box            *SecretBox
+		sealed         string
+		additionalData string
+		wantErr        bool
+	}{
+		{name: "round trip", box: box, sealed: sealed, additionalData: "user-1"},
+		{name: "other row", box: box, sealed: sealed, additionalData: "user-2", wantErr: true},
+		{name: "other key", box: otherKey, sealed: sealed, additionalData: "user-1", wantErr: true},
+		{name: "tampered", box: box, sealed: sealed[:len(sealed)-2] + "AA", additionalData: "user-1", wantErr: true},
+		{name: "plaintext", box: box, sealed: "JBSWY3DPEHPK3PXP", additionalData: "user-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.box.Open(tt.sealed, []byte(tt.additionalData))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != "JBSWY3DPEHPK3PXP" {
+				t.Errorf("Open() = %q", got)
+			}
+		})
+	}
+
+	if _, err := NewSecretBox([]byte("short")); err == nil {
+		t.Errorf("NewSecretBox() accepted a short key")
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignWebhook returns a signature header value of the form "t=<unix>,v1=<hex>"
+// covering the timestamp, the delivery ID and the raw body.
+func SignWebhook(body []byte, deliveryID string, timestamp time.Time, key string) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), webhookSignature(body, deliveryID, timestamp.Unix(), key))
+}
+
+// VerifyWebhookSignature checks a header produced by SignWebhook against each
+// of keys, so that old and new keys are both accepted during rotation. The
+// timestamp must be within tolerance of now.
+func VerifyWebhookSignature(header string, body []byte, deliveryID string, keys []string, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signatures [][]byte
+	for part := range strings.SplitSeq(header, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return fmt.Errorf("malformed signature header")
+		}
+		switch name {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid signature timestamp - %w", err)
+			}
+			timestamp = parsed
+		case "v1":
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("invalid signature encoding - %w", err)
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		expected, _ := hex.DecodeString(webhookSignature(body, deliveryID, timestamp, key))
+		for _, signature := range signatures {
+			if hmac.Equal(signature, expected) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+func webhookSignature(body []byte, deliveryID string, timestamp int64, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d.%s.", timestamp, deliveryID)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
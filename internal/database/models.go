@@ -6,33 +6,276 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	HiddenAt    sql.NullTime
+	PublishAt   sql.NullTime
+	AnnouncedAt sql.NullTime
+}
+
+type Conversation struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	UserOneID uuid.UUID
+	UserTwoID uuid.UUID
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type IdempotencyKey struct {
+	Owner          string
+	IdempotencyKey string
+	Route          string
+	RequestHash    string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	StatusCode     sql.NullInt32
+	ContentType    sql.NullString
+	ResponseBody   []byte
+	LockedUntil    time.Time
+}
+
+type LoginFailure struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+	ReadAt         sql.NullTime
+}
+
+type ModerationAction struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	AdminID   uuid.NullUUID
+	Action    string
+	ReportID  uuid.NullUUID
+	ChirpID   uuid.NullUUID
+	UserID    uuid.NullUUID
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Kind      string
 	Body      string
+	ReadAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	GrantID       uuid.UUID
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           string
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+}
+
+type OauthToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	GrantID   uuid.UUID
+	TokenType string
+	ClientID  string
 	UserID    uuid.UUID
+	Scopes    []string
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type OidcLoginState struct {
+	StateHash    string
+	CreatedAt    time.Time
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	BrowserHash  string
+}
+
+type OutboundWebhook struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	Scope     string
+	Active    bool
+}
+
+type OutboundWebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	Event          string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      string
+	DeliveredAt    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
-type User struct {
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	ID         uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt sql.NullTime
+}
+
+type Report struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ReporterID     uuid.UUID
+	ChirpID        uuid.NullUUID
+	ReportedUserID uuid.UUID
+	Reason         string
+	Details        string
+	Status         string
+	ResolvedBy     uuid.NullUUID
+	ResolvedAt     sql.NullTime
+	ResolutionNote string
+}
+
+type Subscription struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	UserID             uuid.UUID
+	Plan               string
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	SubscriptionID   uuid.UUID
+	Event            string
+	Status           string
+	CurrentPeriodEnd time.Time
+}
+
+type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	SuspendedAt     sql.NullTime
+	Role            string
+	DeletedAt       sql.NullTime
+	EmailVerifiedAt sql.NullTime
+	PendingEmail    sql.NullString
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastStep    int64
+	TokenVersion    int32
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	LastLoginAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID         string
+	ReceivedAt time.Time
+	Event      string
 }
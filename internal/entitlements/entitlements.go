@@ -0,0 +1,74 @@
+package entitlements
+
+import (
+	"errors"
+	"time"
+)
+
+// Entitlements describes what a user's plan allows. Handlers consult it
+// instead of checking is_chirpy_red themselves so the rules live in one place.
+type Entitlements struct {
+	MaxChirpLength    int
+	CanEditChirps     bool
+	CanScheduleChirps bool
+	MaxScheduleAhead  time.Duration
+	RequestsPerMinute int
+}
+
+var Free = Entitlements{
+	MaxChirpLength:    140,
+	CanEditChirps:     false,
+	CanScheduleChirps: false,
+	RequestsPerMinute: 60,
+}
+
+var ChirpyRed = Entitlements{
+	MaxChirpLength:    1000,
+	CanEditChirps:     true,
+	CanScheduleChirps: true,
+	MaxScheduleAhead:  30 * 24 * time.Hour,
+	RequestsPerMinute: 300,
+}
+
+var (
+	ErrChirpTooLong         = errors.New("chirp is too long")
+	ErrEditingNotAllowed    = errors.New("editing chirps requires Chirpy Red")
+	ErrSchedulingNotAllowed = errors.New("scheduling chirps requires Chirpy Red")
+	ErrScheduleNotInFuture  = errors.New("publish_at must be in the future")
+	ErrScheduleTooFarAhead  = errors.New("publish_at is too far in the future")
+)
+
+// For returns the entitlements of a user with the given Chirpy Red status.
+func For(isChirpyRed bool) Entitlements {
+	if isChirpyRed {
+		return ChirpyRed
+	}
+	return Free
+}
+
+func (e Entitlements) CheckChirpBody(body string) error {
+	if len(body) > e.MaxChirpLength {
+		return ErrChirpTooLong
+	}
+	return nil
+}
+
+func (e Entitlements) CheckEdit() error {
+	if !e.CanEditChirps {
+		return ErrEditingNotAllowed
+	}
+	return nil
+}
+
+func (e Entitlements) CheckSchedule(publishAt, now time.Time) error {
+	if !e.CanScheduleChirps {
+		return ErrSchedulingNotAllowed
+	}
+	if !publishAt.After(now) {
+		return ErrScheduleNotInFuture
+	}
+	if publishAt.Sub(now) > e.MaxScheduleAhead {
+		return ErrScheduleTooFarAhead
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package entitlements
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckChirpBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		isChirpyRed bool
+		body        string
+		wantErr     error
+	}{
+		{
+			name:        "free user at limit",
+			isChirpyRed: false,
+			body:        strings.Repeat("a", 140),
+			wantErr:     nil,
+		},
+		{
+			name:        "free user over limit",
+			isChirpyRed: false,
+			body:        strings.Repeat("a", 141),
+			wantErr:     ErrChirpTooLong,
+		},
+		{
+			name:        "red user over free limit",
+			isChirpyRed: true,
+			body:        strings.Repeat("a", 141),
+			wantErr:     nil,
+		},
+		{
+			name:        "red user over red limit",
+			isChirpyRed: true,
+			body:        strings.Repeat("a", 1001),
+			wantErr:     ErrChirpTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := For(tt.isChirpyRed).CheckChirpBody(tt.body)
+			if err != tt.wantErr {
+				t.Errorf("CheckChirpBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckEdit(t *testing.T) {
+	tests := []struct {
+		name        string
+		isChirpyRed bool
+		wantErr     error
+	}{
+		{
+			name:        "free user",
+			isChirpyRed: false,
+			wantErr:     ErrEditingNotAllowed,
+		},
+		{
+			name:        "red user",
+			isChirpyRed: true,
+			wantErr:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := For(tt.isChirpyRed).CheckEdit()
+			if err != tt.wantErr {
+				t.Errorf("CheckEdit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		isChirpyRed bool
+		publishAt   time.Time
+		wantErr     error
+	}{
+		{
+			name:        "free user",
+			isChirpyRed: false,
+			publishAt:   now.Add(time.Hour),
+			wantErr:     ErrSchedulingNotAllowed,
+		},
+		{
+			name:        "red user",
+			isChirpyRed: true,
+			publishAt:   now.Add(time.Hour),
+			wantErr:     nil,
+		},
+		{
+			name:        "red user in the past",
+			isChirpyRed: true,
+			publishAt:   now.Add(-time.Hour),
+			wantErr:     ErrScheduleNotInFuture,
+		},
+		{
+			name:        "red user too far ahead",
+			isChirpyRed: true,
+			publishAt:   now.Add(31 * 24 * time.Hour),
+			wantErr:     ErrScheduleTooFarAhead,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := For(tt.isChirpyRed).CheckSchedule(tt.publishAt, now)
+			if err != tt.wantErr {
+				t.Errorf("CheckSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	if For(true).RequestsPerMinute <= For(false).RequestsPerMinute {
+		t.Errorf("Chirpy Red limit %d should exceed free limit %d", For(true).RequestsPerMinute, For(false).RequestsPerMinute)
+	}
+}
@@ -0,0 +1,222 @@
+// Package idpsim is a minimal OpenID Connect provider for exercising Chirpy's
+// OIDC login without a real identity provider. It implements discovery, JWKS,
+// the authorization endpoint (which logs in Identity without asking) and the
+// token endpoint with PKCE.
+package idpsim
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+)
+
+const idTokenExpiration = 5 * time.Minute
+
+// Identity is the user the provider authenticates.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	// Identity is logged in by every authorization request.
+	Identity Identity
+	// Now returns the time ID tokens are issued at.
+	Now func() time.Time
+
+	server *httptest.Server
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	codes  map[string]authorization
+}
+
+type authorization struct {
+	identity      Identity
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// New starts a provider on a local port. Call Close when done.
+func New(clientID, clientSecret string) (*Provider, error) {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Now:          time.Now,
+		codes:        map[string]authorization{},
+	}
+	if err := p.RotateKey(); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("GET /jwks", p.handleJWKS)
+	mux.HandleFunc("GET /authorize", p.handleAuthorize)
+	mux.HandleFunc("POST /token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	p.Issuer = p.server.URL
+	return p, nil
+}
+
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID, the
+// way providers rotate keys.
+func (p *Provider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.keyID = randomString(8)
+	return nil
+}
+
+// SignIDToken signs arbitrary claims with the current key, for tests that
+// need malformed or hostile ID tokens.
+func (p *Provider) SignIDToken(claims jwt.Claims) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+// IDTokenClaims returns valid claims for identity, which tests can then
+// modify before calling SignIDToken.
+func (p *Provider) IDTokenClaims(identity Identity, nonce string) jwt.MapClaims {
+	now := p.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer,
+		"sub":            identity.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(idTokenExpiration).Unix(),
+		"nonce":          nonce,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+	}
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{oauth.CodeChallengeMethodS256},
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key := p.key.PublicKey
+	keyID := p.keyID
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if err := oauth.ValidateCodeChallenge(query.Get("code_challenge"), query.Get("code_challenge_method")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	code := randomString(16)
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		identity:      p.Identity,
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+	redirectTo, err := oauth.RedirectURL(query.Get("redirect_uri"), map[string][]string{
+		"code":  {code},
+		"state": {query.Get("state")},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, redirectTo, http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, oauth.Error{Code: oauth.ErrInvalidClient})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, oauth.Error{Code: oauth.ErrInvalidRequest})
+		return
+	}
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	grant, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || grant.redirectURI != r.PostForm.Get("redirect_uri") || !oauth.VerifyPKCE(r.PostForm.Get("code_verifier"), grant.codeChallenge) {
+		writeJSON(w, http.StatusBadRequest, oauth.Error{Code: oauth.ErrInvalidGrant})
+		return
+	}
+	idToken, err := p.SignIDToken(p.IDTokenClaims(grant.identity, grant.nonce))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, oauth.Error{Code: oauth.ErrServerError})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(16),
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenExpiration.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
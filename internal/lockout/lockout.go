@@ -0,0 +1,61 @@
+// Package lockout decides how failed login attempts are slowed down and when
+// an account or client is temporarily locked out.
+package lockout
+
+import "time"
+
+type Policy struct {
+	// Threshold is the number of failures within Window before the first
+	// lockout.
+	Threshold int
+	// Window is how long a failure counts towards the threshold.
+	Window time.Duration
+	// Lockout is the first lockout. It doubles for every further failure up
+	// to MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// DelayStep is added to the response time of each failure below the
+	// threshold, up to MaxDelay.
+	DelayStep time.Duration
+	MaxDelay  time.Duration
+}
+
+// Account applies to failures against a single email address.
+var Account = Policy{
+	Threshold:  5,
+	Window:     15 * time.Minute,
+	Lockout:    time.Minute,
+	MaxLockout: time.Hour,
+	DelayStep:  250 * time.Millisecond,
+	MaxDelay:   2 * time.Second,
+}
+
+// Client applies to failures from a single IP address, which may try many
+// email addresses.
+var Client = Policy{
+	Threshold:  50,
+	Window:     15 * time.Minute,
+	Lockout:    5 * time.Minute,
+	MaxLockout: time.Hour,
+}
+
+// LockoutFor returns how long to lock out after failures failures within the
+// window. It is zero below the threshold.
+func (p Policy) LockoutFor(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	lockout := p.Lockout
+	for i := p.Threshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return lockout
+}
+
+// Delay returns how long to hold the response to a failed attempt.
+func (p Policy) Delay(failures int) time.Duration {
+	return min(time.Duration(failures)*p.DelayStep, p.MaxDelay)
+}
@@ -0,0 +1,45 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 4, want: 0},
+		{failures: 5, want: time.Minute},
+		{failures: 6, want: 2 * time.Minute},
+		{failures: 8, want: 8 * time.Minute},
+		{failures: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Account.LockoutFor(tt.failures); got != tt.want {
+			t.Errorf("LockoutFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 1, want: 250 * time.Millisecond},
+		{failures: 4, want: time.Second},
+		{failures: 20, want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := Account.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := Client.Delay(10); got != 0 {
+		t.Errorf("Client.Delay(10) = %v, want 0", got)
+	}
+}
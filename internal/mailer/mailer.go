@@ -0,0 +1,101 @@
+// Package mailer sends transactional email such as password reset links.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating with PLAIN
+// auth when Username is set. From may include a display name, as in
+// "Chirpy <no-reply@example.com>"; only the address is used as the envelope
+// sender.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address - %w", err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q - %w", m.From, err)
+	}
+	body, err := buildMessage(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.Addr, auth, from.Address, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("error sending mail to %s - %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogMailer writes each message to Writer instead of sending it. It is used
+// in development, pointed at stdout or a local file.
+type LogMailer struct {
+	Writer io.Writer
+	From   string
+	mu     sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	body, err := buildMessage(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(m.Writer, "%s\r\n\r\n", body); err != nil {
+		return fmt.Errorf("error writing mail - %w", err)
+	}
+	return nil
+}
+
+// buildMessage renders msg as an RFC 5322 plain-text message.
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("mail headers must not contain line breaks")
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
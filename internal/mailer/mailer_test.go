@@ -0,0 +1,133 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		msg     Message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "headers and body",
+			msg:  Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"},
+			want: []string{
+				"From: chirpy@example.com\r\n",
+				"To: user@example.com\r\n",
+				"Subject: Hello\r\n",
+				"\r\n\r\nline one\r\nline two",
+			},
+		},
+		{
+			name:    "header injection",
+			msg:     Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildMessage("chirpy@example.com", tt.msg, date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(string(got), part) {
+					t.Errorf("buildMessage() = %q, missing %q", got, part)
+				}
+			}
+		})
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := &LogMailer{Writer: &buf, From: "chirpy@example.com"}
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "To: user@example.com") || !strings.Contains(buf.String(), "token") {
+		t.Errorf("LogMailer wrote %q", buf.String())
+	}
+}
+
+// fakeSMTPServer accepts one session on a loopback listener, answers every
+// command with success and returns the commands and message it received.
+func fakeSMTPServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		defer func() { received <- lines }()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ready\r\n"))
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case inData:
+				if line == "." {
+					inData = false
+					conn.Write([]byte("250 queued\r\n"))
+				}
+			case line == "DATA":
+				inData = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case line == "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	m := &SMTPMailer{Addr: addr, From: "Chirpy <no-reply@chirpy.local>"}
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	session := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@chirpy.local>",
+		"RCPT TO:<user@example.com>",
+		"From: Chirpy <no-reply@chirpy.local>",
+		"token",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("SMTP session is missing %q:\n%s", want, session)
+		}
+	}
+
+	m.From = "not an address"
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "token"}); err == nil {
+		t.Errorf("Send() with an invalid sender succeeded")
+	}
+}
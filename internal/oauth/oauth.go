@@ -0,0 +1,196 @@
+// Package oauth implements the protocol details of the OAuth 2.0
+// authorization-code flow with PKCE (RFC 6749, RFC 7636): token formats,
+// redirect URI and scope rules, and the error responses clients expect.
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+)
+
+const (
+	AuthorizationCodeExpiration = 10 * time.Minute
+	AccessTokenExpiration       = time.Hour
+	RefreshTokenExpiration      = 30 * 24 * time.Hour
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// Access and refresh tokens are opaque, prefixed random strings so that they
+// can be revoked immediately and told apart from other bearer tokens.
+const (
+	AccessTokenPrefix  = "chirpy_oat_"
+	RefreshTokenPrefix = "chirpy_ort_"
+	clientSecretPrefix = "chirpy_ocs_"
+)
+
+const CodeChallengeMethodS256 = "S256"
+
+// Error codes from RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrInvalidScope            = "invalid_scope"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+)
+
+// Error is the JSON body of an OAuth error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func MakeAccessToken() (string, error) {
+	return makeToken(AccessTokenPrefix)
+}
+
+func MakeRefreshToken() (string, error) {
+	return makeToken(RefreshTokenPrefix)
+}
+
+func MakeClientSecret() (string, error) {
+	return makeToken(clientSecretPrefix)
+}
+
+// MakeCode returns an authorization code. Codes are single use and short
+// lived, so they carry no prefix.
+func MakeCode() (string, error) {
+	return auth.MakeRefreshToken()
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+func makeToken(prefix string) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return prefix + token, nil
+}
+
+// VerifyPKCE checks a code_verifier against the S256 code_challenge sent to
+// the authorization endpoint.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !validVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
+
+// S256Challenge derives the code_challenge for a code_verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidateCodeChallenge checks the PKCE parameters of an authorization
+// request. Only S256 is accepted; the plain method offers no protection if the
+// request is observed.
+func ValidateCodeChallenge(challenge, method string) error {
+	if challenge == "" {
+		return Error{Code: ErrInvalidRequest, Description: "code_challenge is required"}
+	}
+	if method != CodeChallengeMethodS256 {
+		return Error{Code: ErrInvalidRequest, Description: "code_challenge_method must be S256"}
+	}
+	if len(challenge) != 43 {
+		return Error{Code: ErrInvalidRequest, Description: "code_challenge is malformed"}
+	}
+	return nil
+}
+
+// validVerifier follows RFC 7636 section 4.1: 43 to 128 unreserved characters.
+func validVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateRedirectURI accepts absolute https URIs without a fragment, and
+// http only for loopback addresses used by native and local clients.
+func ValidateRedirectURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("redirect URI %q must be an absolute URL", uri)
+	}
+	if parsed.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not have a fragment", uri)
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if isLoopback(parsed.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must use https", uri)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ParseScope splits a space-delimited scope parameter.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// RedirectURL appends params to the client's redirect URI, keeping any query
+// it was registered with.
+func RedirectURL(redirectURI string, params url.Values) (string, error) {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
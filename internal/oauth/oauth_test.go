@@ -0,0 +1,118 @@
+package oauth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{
+			name:      "matching verifier",
+			verifier:  verifier,
+			challenge: challenge,
+			want:      true,
+		},
+		{
+			name:      "wrong verifier",
+			verifier:  strings.Repeat("a", 43),
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "verifier too short",
+			verifier:  verifier[:42],
+			challenge: S256Challenge(verifier[:42]),
+			want:      false,
+		},
+		{
+			name:      "verifier with invalid characters",
+			verifier:  strings.Repeat("a", 42) + "+",
+			challenge: S256Challenge(strings.Repeat("a", 42) + "+"),
+			want:      false,
+		},
+		{
+			name:      "plain challenge",
+			verifier:  verifier,
+			challenge: verifier,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCodeChallenge(t *testing.T) {
+	challenge := S256Challenge(strings.Repeat("v", 43))
+	if err := ValidateCodeChallenge(challenge, CodeChallengeMethodS256); err != nil {
+		t.Errorf("ValidateCodeChallenge() error = %v", err)
+	}
+	if err := ValidateCodeChallenge(challenge, "plain"); err == nil {
+		t.Errorf("ValidateCodeChallenge() accepted the plain method")
+	}
+	if err := ValidateCodeChallenge("", CodeChallengeMethodS256); err == nil {
+		t.Errorf("ValidateCodeChallenge() accepted an empty challenge")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr bool
+	}{
+		{uri: "https://app.example.com/callback", wantErr: false},
+		{uri: "http://127.0.0.1:8765/callback", wantErr: false},
+		{uri: "http://localhost/callback", wantErr: false},
+		{uri: "http://app.example.com/callback", wantErr: true},
+		{uri: "https://app.example.com/callback#frag", wantErr: true},
+		{uri: "/callback", wantErr: true},
+		{uri: "javascript:alert(1)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			err := ValidateRedirectURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedirectURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedirectURL(t *testing.T) {
+	got, err := RedirectURL("https://app.example.com/callback?tenant=1", url.Values{"code": {"abc"}, "state": {"x y"}})
+	if err != nil {
+		t.Fatalf("RedirectURL() error = %v", err)
+	}
+	want := "https://app.example.com/callback?code=abc&state=x+y&tenant=1"
+	if got != want {
+		t.Errorf("RedirectURL() = %q, want %q", got, want)
+	}
+}
+
+func TestTokenPrefixes(t *testing.T) {
+	access, _ := MakeAccessToken()
+	refresh, _ := MakeRefreshToken()
+	if !IsAccessToken(access) {
+		t.Errorf("IsAccessToken(%q) = false", access)
+	}
+	if IsAccessToken(refresh) {
+		t.Errorf("IsAccessToken() = true for a refresh token")
+	}
+}
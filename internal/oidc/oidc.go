@@ -0,0 +1,333 @@
+// Package oidc is an OpenID Connect relying party. It discovers a provider's
+// endpoints, builds authorization-code requests with PKCE, exchanges codes for
+// ID tokens and validates them against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+)
+
+const (
+	discoveryPath     = "/.well-known/openid-configuration"
+	requestTimeout    = 10 * time.Second
+	jwksRefetchPeriod = time.Minute
+	// clockSkew is the leeway allowed when checking ID token times.
+	clockSkew = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	errUnknownKey     = errors.New("ID token signed with an unknown key")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// Claims are the ID token claims Chirpy uses.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	AuthorizedParty string   `json:"azp"`
+}
+
+// flexBool accepts both JSON booleans and the strings "true" and "false",
+// which some providers send for email_verified.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// RelyingParty talks to one provider. Discovery and key fetching happen on
+// first use, so a provider that is briefly down does not stop Chirpy from
+// starting.
+type RelyingParty struct {
+	config Config
+	Client *http.Client
+	// Now returns the time ID tokens are checked against.
+	Now func() time.Time
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func New(config Config) *RelyingParty {
+	return &RelyingParty{
+		config: config,
+		Client: &http.Client{Timeout: requestTimeout},
+		Now:    time.Now,
+	}
+}
+
+// Issuer returns the configured issuer, which identifies the provider in
+// stored identities.
+func (rp *RelyingParty) Issuer() string {
+	return rp.config.Issuer
+}
+
+// AuthorizationURL returns the provider URL to send the user to. state and
+// nonce must be random and remembered until the callback, along with
+// codeVerifier.
+func (rp *RelyingParty) AuthorizationURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := rp.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.config.ClientID},
+		"redirect_uri":          {rp.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, rp.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {oauth.S256Challenge(codeVerifier)},
+		"code_challenge_method": {oauth.CodeChallengeMethodS256},
+	}
+	return oauth.RedirectURL(metadata.AuthorizationEndpoint, params)
+}
+
+// Exchange redeems an authorization code and returns the validated ID token
+// claims.
+func (rp *RelyingParty) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	metadata, err := rp.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rp.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(rp.config.ClientID), url.QueryEscape(rp.config.ClientSecret))
+	resp, err := rp.Client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error calling token endpoint - %w", err)
+	}
+	defer resp.Body.Close()
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return Claims{}, fmt.Errorf("error decoding token response - %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return Claims{}, fmt.Errorf("token response has no id_token")
+	}
+	return rp.VerifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+// VerifyIDToken checks the token's signature against the provider's keys and
+// its issuer, audience, expiry and nonce (OpenID Connect Core 3.1.3.7).
+func (rp *RelyingParty) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	metadata, err := rp.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	claims := Claims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return rp.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(rp.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithTimeFunc(rp.Now),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w - %w", ErrInvalidIDToken, err)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != rp.config.ClientID {
+		return Claims{}, fmt.Errorf("%w - azp does not match client", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w - nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w - missing sub", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func (rp *RelyingParty) discover(ctx context.Context) (*providerMetadata, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.metadata != nil {
+		return rp.metadata, nil
+	}
+	var metadata providerMetadata
+	if err := rp.getJSON(ctx, strings.TrimSuffix(rp.config.Issuer, "/")+discoveryPath, &metadata); err != nil {
+		return nil, fmt.Errorf("error discovering provider - %w", err)
+	}
+	// The discovered issuer must be the one configured, otherwise a
+	// compromised document could make us accept another provider's tokens.
+	if metadata.Issuer != rp.config.Issuer {
+		return nil, fmt.Errorf("discovered issuer %q does not match %q", metadata.Issuer, rp.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("provider metadata is incomplete")
+	}
+	rp.metadata = &metadata
+	return rp.metadata, nil
+}
+
+// key returns the public key with the given ID. The key set is fetched again
+// when an unknown key ID shows up, at most once per jwksRefetchPeriod, so
+// provider key rotation is picked up without restarting.
+func (rp *RelyingParty) key(ctx context.Context, kid string) (any, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if key, ok := rp.keys[kid]; ok {
+		return key, nil
+	}
+	if rp.keys != nil && rp.Now().Sub(rp.keysFetchedAt) < jwksRefetchPeriod {
+		return nil, errUnknownKey
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := rp.getJSON(ctx, rp.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("error fetching JWKS - %w", err)
+	}
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	rp.keys = keys
+	rp.keysFetchedAt = rp.Now()
+	if key, ok := rp.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+func (rp *RelyingParty) getJSON(ctx context.Context, url string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := rp.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC key - %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
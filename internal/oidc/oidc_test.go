@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panaiotuzunov/Chirpy/internal/idpsim"
+)
+
+func newTestProvider(t *testing.T) (*idpsim.Provider, *RelyingParty) {
+	t.Helper()
+	provider, err := idpsim.New("chirpy", "client-secret")
+	if err != nil {
+		t.Fatalf("idpsim.New() error = %v", err)
+	}
+	t.Cleanup(provider.Close)
+	provider.Identity = idpsim.Identity{Subject: "employee-1", Email: "employee@example.com", EmailVerified: true}
+	rp := New(Config{
+		Issuer:       provider.Issuer,
+		ClientID:     "chirpy",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://127.0.0.1/callback",
+		Scopes:       []string{"email"},
+	})
+	return provider, rp
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	_, rp := newTestProvider(t)
+	ctx := context.Background()
+	verifier := strings.Repeat("v", 64)
+	authURL, err := rp.AuthorizationURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL() error = %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET authorization URL error = %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("state") != "state-1" {
+		t.Fatalf("callback = %q, want state-1", resp.Header.Get("Location"))
+	}
+
+	if _, err := rp.Exchange(ctx, callback.Query().Get("code"), strings.Repeat("w", 64), "nonce-1"); err == nil {
+		t.Errorf("Exchange() accepted a wrong code verifier")
+	}
+	resp, _ = client.Get(authURL)
+	resp.Body.Close()
+	callback, _ = url.Parse(resp.Header.Get("Location"))
+	claims, err := rp.Exchange(ctx, callback.Query().Get("code"), verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if claims.Subject != "employee-1" || claims.Email != "employee@example.com" || !claims.EmailVerified {
+		t.Errorf("Exchange() claims = %+v", claims)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, rp := newTestProvider(t)
+	identity := provider.Identity
+
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name:    "valid token",
+			modify:  func(jwt.MapClaims) {},
+			nonce:   "nonce",
+			wantErr: false,
+		},
+		{
+			name:    "wrong nonce",
+			modify:  func(jwt.MapClaims) {},
+			nonce:   "other-nonce",
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			modify:  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "several audiences without azp",
+			modify:  func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "someone-else"} },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			modify:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			modify:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "missing expiry",
+			modify:  func(c jwt.MapClaims) { delete(c, "exp") },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := provider.IDTokenClaims(identity, "nonce")
+			tt.modify(claims)
+			token, err := provider.SignIDToken(claims)
+			if err != nil {
+				t.Fatalf("SignIDToken() error = %v", err)
+			}
+			_, err = rp.VerifyIDToken(context.Background(), token, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("HMAC signed token", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, provider.IDTokenClaims(identity, "nonce")).SignedString([]byte("client-secret"))
+		if _, err := rp.VerifyIDToken(context.Background(), token, "nonce"); err == nil {
+			t.Errorf("VerifyIDToken() accepted an HS256 token")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	provider, rp := newTestProvider(t)
+	now := time.Now()
+	rp.Now = func() time.Time { return now }
+	sign := func() string {
+		token, err := provider.SignIDToken(provider.IDTokenClaims(provider.Identity, "nonce"))
+		if err != nil {
+			t.Fatalf("SignIDToken() error = %v", err)
+		}
+		return token
+	}
+	if _, err := rp.VerifyIDToken(context.Background(), sign(), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if err := provider.RotateKey(); err != nil {
+		t.Fatalf("RotateKey() error = %v", err)
+	}
+	rotated := sign()
+	if _, err := rp.VerifyIDToken(context.Background(), rotated, "nonce"); err == nil {
+		t.Errorf("VerifyIDToken() refetched keys before the refetch period")
+	}
+	now = now.Add(2 * jwksRefetchPeriod)
+	provider.Now = func() time.Time { return now }
+	if _, err := rp.VerifyIDToken(context.Background(), sign(), "nonce"); err != nil {
+		t.Errorf("VerifyIDToken() after rotation error = %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	// Discovery is fetched from the same URL, but the document names an
+	// issuer without the trailing slash.
+	rp := New(Config{Issuer: provider.Issuer + "/", ClientID: "chirpy"})
+	if _, err := rp.AuthorizationURL(context.Background(), "state", "nonce", strings.Repeat("v", 64)); err == nil {
+		t.Errorf("AuthorizationURL() accepted a provider with a different issuer")
+	}
+}
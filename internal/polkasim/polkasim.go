@@ -0,0 +1,156 @@
+// Package polkasim sends Polka webhook deliveries to a running Chirpy so the
+// webhook flow can be exercised without a Polka account.
+package polkasim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+)
+
+type Event struct {
+	Name        string
+	UserID      uuid.UUID
+	Plan        string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// Delivery is a single signed webhook. Sending the same Delivery twice reuses
+// its ID, which is how Polka retries look to the receiver.
+type Delivery struct {
+	ID    string
+	Event Event
+	Body  []byte
+}
+
+type Simulator struct {
+	URL         string
+	Key         string
+	Client      *http.Client
+	MaxAttempts int
+	RetryDelay  time.Duration
+	// Now returns the time used to sign deliveries.
+	Now func() time.Time
+}
+
+type payload struct {
+	Event string      `json:"event"`
+	Data  payloadData `json:"data"`
+}
+type payloadData struct {
+	UserID      uuid.UUID  `json:"user_id"`
+	Plan        string     `json:"plan,omitempty"`
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+}
+
+func New(url, key string) *Simulator {
+	return &Simulator{
+		URL:         url,
+		Key:         key,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		RetryDelay:  500 * time.Millisecond,
+		Now:         time.Now,
+	}
+}
+
+// NewDelivery builds a delivery for event with a fresh delivery ID.
+func NewDelivery(event Event) (Delivery, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return Delivery{}, fmt.Errorf("failed to generate delivery ID: %w", err)
+	}
+	data := payloadData{UserID: event.UserID, Plan: event.Plan}
+	if !event.PeriodStart.IsZero() {
+		data.PeriodStart = &event.PeriodStart
+	}
+	if !event.PeriodEnd.IsZero() {
+		data.PeriodEnd = &event.PeriodEnd
+	}
+	body, err := json.Marshal(payload{Event: event.Name, Data: data})
+	if err != nil {
+		return Delivery{}, fmt.Errorf("error marshaling event - %w", err)
+	}
+	return Delivery{ID: "evt_" + hex.EncodeToString(idBytes), Event: event, Body: body}, nil
+}
+
+// Send makes one attempt at delivery and returns the response status code.
+func (s *Simulator) Send(ctx context.Context, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request - %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Polka-Delivery-Id", delivery.ID)
+	req.Header.Set("Polka-Signature", auth.SignWebhook(delivery.Body, delivery.ID, s.Now(), s.Key))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Deliver sends delivery like Polka does, retrying network errors and 5xx
+// responses with exponential backoff. It returns the last status code.
+func (s *Simulator) Deliver(ctx context.Context, delivery Delivery) (int, error) {
+	delay := s.RetryDelay
+	var status int
+	var err error
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		status, err = s.Send(ctx, delivery)
+		if err == nil && status < http.StatusInternalServerError {
+			return status, nil
+		}
+		if attempt == s.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return status, fmt.Errorf("delivery %s failed after %d attempts - %w", delivery.ID, s.MaxAttempts, err)
+	}
+	return status, fmt.Errorf("delivery %s failed after %d attempts with status %d", delivery.ID, s.MaxAttempts, status)
+}
+
+// DeliverDuplicate delivers the same delivery times times, as Polka does when
+// it does not see an acknowledgement.
+func (s *Simulator) DeliverDuplicate(ctx context.Context, delivery Delivery, times int) ([]int, error) {
+	var statuses []int
+	for range times {
+		status, err := s.Deliver(ctx, delivery)
+		if err != nil {
+			return statuses, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// DeliverOutOfOrder delivers deliveries in reverse order.
+func (s *Simulator) DeliverOutOfOrder(ctx context.Context, deliveries []Delivery) ([]int, error) {
+	var statuses []int
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		status, err := s.Deliver(ctx, deliveries[i])
+		if err != nil {
+			return statuses, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,125 @@
+package polkasim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+)
+
+type receiver struct {
+	mu          sync.Mutex
+	deliveryIDs []string
+	failures    int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	deliveryID := req.Header.Get("Polka-Delivery-Id")
+	if err := auth.VerifyWebhookSignature(req.Header.Get("Polka-Signature"), body, deliveryID, []string{"key"}, time.Minute, time.Now()); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.deliveryIDs = append(r.deliveryIDs, deliveryID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestSimulator(t *testing.T, r *receiver, key string) *Simulator {
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	sim := New(server.URL, key)
+	sim.RetryDelay = time.Millisecond
+	return sim
+}
+
+func TestDeliverSignsRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+	}{
+		{
+			name:       "matching key",
+			key:        "key",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "wrong key",
+			key:        "other",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newTestSimulator(t, &receiver{}, tt.key)
+			delivery, err := NewDelivery(Event{Name: "user.upgraded", UserID: uuid.New()})
+			if err != nil {
+				t.Fatalf("NewDelivery() error = %v", err)
+			}
+			status, err := sim.Deliver(context.Background(), delivery)
+			if err != nil {
+				t.Fatalf("Deliver() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Deliver() status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	r := &receiver{failures: 2}
+	sim := newTestSimulator(t, r, "key")
+	delivery, _ := NewDelivery(Event{Name: "user.upgraded", UserID: uuid.New()})
+
+	status, err := sim.Deliver(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("Deliver() status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	r.failures = sim.MaxAttempts
+	if _, err := sim.Deliver(context.Background(), delivery); err == nil {
+		t.Errorf("Deliver() expected error after %d failed attempts", sim.MaxAttempts)
+	}
+}
+
+func TestDeliverDuplicateAndOutOfOrder(t *testing.T) {
+	r := &receiver{}
+	sim := newTestSimulator(t, r, "key")
+	first, _ := NewDelivery(Event{Name: "user.upgraded", UserID: uuid.New()})
+	second, _ := NewDelivery(Event{Name: "user.downgraded", UserID: uuid.New()})
+
+	if _, err := sim.DeliverDuplicate(context.Background(), first, 2); err != nil {
+		t.Fatalf("DeliverDuplicate() error = %v", err)
+	}
+	if _, err := sim.DeliverOutOfOrder(context.Background(), []Delivery{first, second}); err != nil {
+		t.Fatalf("DeliverOutOfOrder() error = %v", err)
+	}
+
+	want := []string{first.ID, first.ID, second.ID, first.ID}
+	if len(r.deliveryIDs) != len(want) {
+		t.Fatalf("received %d deliveries, want %d", len(r.deliveryIDs), len(want))
+	}
+	for i := range want {
+		if r.deliveryIDs[i] != want[i] {
+			t.Errorf("delivery %d = %s, want %s", i, r.deliveryIDs[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package ratelimit implements token-bucket rate limits. Buckets live in a
+// Store, so limits can be kept in memory for a single instance or in a shared
+// store when several instances serve the same clients.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// Limit allows Requests per Period on average, with bursts of up to Burst
+// requests at once.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	// Burst is the size of the bucket. Zero means Requests.
+	Burst int
+}
+
+// PerMinute returns a limit of n requests a minute that can all be made at
+// once.
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// interval is how long it takes to refill one token.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Bucket is the state of one client's bucket. A new bucket is full.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Result describes a request's outcome and the bucket left behind.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed. It is zero
+	// when Remaining is above zero.
+	RetryAfter time.Duration
+}
+
+// Take refills bucket for the time since it was last updated and takes one
+// token from it if it has one. Stores call it with the bucket stored for a
+// key, or the zero Bucket for a new key, and save the returned bucket.
+func (l Limit) Take(bucket Bucket, now time.Time) (Bucket, Result) {
+	burst := float64(l.burst())
+	tokens := burst
+	if !bucket.Updated.IsZero() {
+		elapsed := max(now.Sub(bucket.Updated), 0)
+		tokens = min(bucket.Tokens+float64(elapsed)/float64(l.interval()), burst)
+	}
+	result := Result{Limit: l}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((burst - tokens) * float64(l.interval()))
+	if tokens < 1 {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(l.interval()))
+	}
+	return Bucket{Tokens: tokens, Updated: now}, result
+}
+
+// Store keeps buckets by key. Take must be atomic for each key, or
+// concurrent requests could all spend the same token.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// MemoryStore keeps buckets in process memory. Buckets that have refilled
+// completely are dropped, since a new bucket is full anyway.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	// full is when the bucket will have refilled completely.
+	full time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]memoryBucket{}}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	bucket, result := limit.Take(s.buckets[key].Bucket, now)
+	s.buckets[key] = memoryBucket{Bucket: bucket, full: now.Add(result.Reset)}
+	return result, nil
+}
+
+// SetHeaders sets the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers from the IETF RateLimit header fields draft,
+// and Retry-After when the request was not allowed.
+func SetHeaders(header http.Header, result Result) {
+	header.Set("RateLimit-Limit", fmt.Sprint(result.Limit.burst()))
+	header.Set("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+	header.Set("RateLimit-Reset", fmt.Sprint(seconds(result.Reset)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit.Requests, seconds(result.Limit.Period)))
+	if !result.Allowed {
+		header.Set("Retry-After", fmt.Sprint(seconds(result.RetryAfter)))
+	}
+}
+
+// seconds rounds up, so clients never retry early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	limit := Limit{Requests: 60, Period: time.Minute, Burst: 3}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		at            time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "new bucket is full", at: 0, wantAllowed: true, wantRemaining: 2},
+		{name: "burst", at: 0, wantAllowed: true, wantRemaining: 1},
+		{name: "last token", at: 0, wantAllowed: true, wantRemaining: 0, wantRetry: time.Second},
+		{name: "empty", at: 0, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{name: "refilled one token", at: time.Second, wantAllowed: true, wantRemaining: 0, wantRetry: time.Second},
+		{name: "refill stops at burst", at: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+
+	bucket := Bucket{}
+	for _, tt := range tests {
+		var result Result
+		bucket, result = limit.Take(bucket, start.Add(tt.at))
+		if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining || result.RetryAfter != tt.wantRetry {
+			t.Errorf("%s: Take() = %+v, want allowed %v, remaining %d, retry after %v", tt.name, result, tt.wantAllowed, tt.wantRemaining, tt.wantRetry)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(2)
+	now := time.Now()
+	ctx := context.Background()
+	for i, want := range []bool{true, true, false} {
+		result, _ := store.Take(ctx, "a", limit, now)
+		if result.Allowed != want {
+			t.Errorf("request %d to a allowed = %v, want %v", i, result.Allowed, want)
+		}
+	}
+	if result, _ := store.Take(ctx, "b", limit, now); !result.Allowed {
+		t.Errorf("request to b was limited by a's bucket")
+	}
+	later := now.Add(2 * sweepInterval)
+	store.Take(ctx, "c", limit, later)
+	if _, ok := store.buckets["a"]; ok {
+		t.Errorf("full bucket for a was not swept")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	_, result := PerMinute(1).Take(Bucket{Tokens: 0, Updated: time.Now()}, time.Now())
+	header := http.Header{}
+	SetHeaders(header, result)
+	want := map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Policy":    "1;w=60",
+		"Retry-After":         "60",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "untrusted peer cannot spoof",
+			remoteAddr:   "203.0.113.7:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy",
+			remoteAddr:   "10.1.2.3:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "client supplied entries are skipped",
+			remoteAddr:   "10.1.2.3:1234",
+			forwardedFor: []string{"1.1.1.1, 198.51.100.1", "192.168.1.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "invalid entry stops the walk",
+			remoteAddr:   "10.1.2.3:1234",
+			forwardedFor: []string{"198.51.100.1, garbage, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.1.2.3:1234",
+			want:       "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(req, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Errorf("ParseTrustedProxies() accepted an invalid prefix")
+	}
+}
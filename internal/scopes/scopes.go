@@ -0,0 +1,58 @@
+// Package scopes defines the permissions that can be granted to credentials
+// other than a full login session, such as personal access tokens.
+package scopes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	ChirpsRead         = "chirps:read"
+	ChirpsWrite        = "chirps:write"
+	ProfileRead        = "profile:read"
+	ProfileWrite       = "profile:write"
+	MessagesRead       = "messages:read"
+	MessagesWrite      = "messages:write"
+	NotificationsRead  = "notifications:read"
+	NotificationsWrite = "notifications:write"
+)
+
+var errNoScopes = errors.New("at least one scope is required")
+
+// All lists every scope that can be granted.
+var All = map[string]bool{
+	ChirpsRead:         true,
+	ChirpsWrite:        true,
+	ProfileRead:        true,
+	ProfileWrite:       true,
+	MessagesRead:       true,
+	MessagesWrite:      true,
+	NotificationsRead:  true,
+	NotificationsWrite: true,
+}
+
+// Normalize checks that every requested scope exists and returns them sorted
+// without duplicates.
+func Normalize(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errNoScopes
+	}
+	result := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !All[scope] {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		result = append(result, scope)
+	}
+	slices.Sort(result)
+	return slices.Compact(result), nil
+}
+
+// Has reports whether granted includes scope.
+func Has(granted []string, scope string) bool {
+	return slices.Contains(granted, scope)
+}
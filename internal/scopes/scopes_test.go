@@ -0,0 +1,58 @@
+package scopes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "sorted and deduplicated",
+			requested: []string{ChirpsWrite, ChirpsRead, ChirpsWrite},
+			want:      []string{ChirpsRead, ChirpsWrite},
+		},
+		{
+			name:      "surrounding whitespace",
+			requested: []string{" profile:read "},
+			want:      []string{ProfileRead},
+		},
+		{
+			name:      "unknown scope",
+			requested: []string{ChirpsRead, "admin"},
+			wantErr:   true,
+		},
+		{
+			name:      "no scopes",
+			requested: nil,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Normalize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHas(t *testing.T) {
+	granted := []string{ChirpsRead, ProfileRead}
+	if !Has(granted, ChirpsRead) {
+		t.Errorf("Has() = false for a granted scope")
+	}
+	if Has(granted, ChirpsWrite) {
+		t.Errorf("Has() = true for a scope that was not granted")
+	}
+}
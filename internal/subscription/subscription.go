@@ -0,0 +1,112 @@
+package subscription
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+	StatusRefunded = "refunded"
+	StatusExpired  = "expired"
+)
+
+const (
+	EventUpgraded      = "user.upgraded"
+	EventDowngraded    = "user.downgraded"
+	EventRenewed       = "subscription.renewed"
+	EventPaymentFailed = "payment.failed"
+	EventRefunded      = "payment.refunded"
+
+	// EventExpired is recorded by the expiry job; Polka never sends it.
+	EventExpired = "subscription.expired"
+)
+
+const DefaultPlan = "chirpy_red"
+
+// DefaultPeriod is used when an event does not say when the period ends.
+const DefaultPeriod = 30 * 24 * time.Hour
+
+var ErrUnknownEvent = errors.New("unknown subscription event")
+var ErrNoSubscription = errors.New("no subscription to update")
+
+type State struct {
+	Plan        string
+	Status      string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+type Event struct {
+	Name        string
+	Plan        string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// IsPolkaEvent reports whether name is a Polka event that Apply understands.
+func IsPolkaEvent(name string) bool {
+	switch name {
+	case EventUpgraded, EventDowngraded, EventRenewed, EventPaymentFailed, EventRefunded:
+		return true
+	}
+	return false
+}
+
+// Apply returns the subscription state after event. current is nil when the
+// user has never subscribed, in which case only an upgrade is accepted.
+func Apply(current *State, event Event, now time.Time) (State, error) {
+	switch event.Name {
+	case EventUpgraded, EventRenewed:
+		next := State{Plan: DefaultPlan, Status: StatusActive, PeriodStart: now}
+		if current != nil {
+			next.Plan = current.Plan
+			// A renewal continues from the end of a period that has not
+			// lapsed yet instead of dropping the remaining time.
+			if event.Name == EventRenewed && current.PeriodEnd.After(now) {
+				next.PeriodStart = current.PeriodEnd
+			}
+		} else if event.Name == EventRenewed {
+			return State{}, ErrNoSubscription
+		}
+		if event.Plan != "" {
+			next.Plan = event.Plan
+		}
+		if !event.PeriodStart.IsZero() {
+			next.PeriodStart = event.PeriodStart
+		}
+		next.PeriodEnd = next.PeriodStart.Add(DefaultPeriod)
+		if !event.PeriodEnd.IsZero() {
+			next.PeriodEnd = event.PeriodEnd
+		}
+		return next, nil
+	case EventDowngraded, EventPaymentFailed, EventRefunded:
+		if current == nil {
+			return State{}, ErrNoSubscription
+		}
+		next := *current
+		switch event.Name {
+		case EventDowngraded:
+			// Members keep what they paid for until the period ends.
+			next.Status = StatusCanceled
+		case EventPaymentFailed:
+			next.Status = StatusPastDue
+		case EventRefunded:
+			next.Status = StatusRefunded
+			next.PeriodEnd = now
+		}
+		return next, nil
+	}
+	return State{}, ErrUnknownEvent
+}
+
+// Entitled reports whether the subscription currently grants Chirpy Red.
+func (s State) Entitled(now time.Time) bool {
+	switch s.Status {
+	case StatusActive, StatusPastDue, StatusCanceled:
+		return now.Before(s.PeriodEnd)
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	active := &State{
+		Plan:        DefaultPlan,
+		Status:      StatusActive,
+		PeriodStart: now.Add(-10 * 24 * time.Hour),
+		PeriodEnd:   now.Add(20 * 24 * time.Hour),
+	}
+	lapsed := &State{
+		Plan:        DefaultPlan,
+		Status:      StatusExpired,
+		PeriodStart: now.Add(-40 * 24 * time.Hour),
+		PeriodEnd:   now.Add(-10 * 24 * time.Hour),
+	}
+
+	tests := []struct {
+		name         string
+		current      *State
+		event        Event
+		wantStatus   string
+		wantEnd      time.Time
+		wantEntitled bool
+		wantErr      error
+	}{
+		{
+			name:         "first upgrade",
+			current:      nil,
+			event:        Event{Name: EventUpgraded},
+			wantStatus:   StatusActive,
+			wantEnd:      now.Add(DefaultPeriod),
+			wantEntitled: true,
+		},
+		{
+			name:         "upgrade with explicit period end",
+			current:      nil,
+			event:        Event{Name: EventUpgraded, PeriodEnd: now.Add(time.Hour)},
+			wantStatus:   StatusActive,
+			wantEnd:      now.Add(time.Hour),
+			wantEntitled: true,
+		},
+		{
+			name:         "renewal extends an active period",
+			current:      active,
+			event:        Event{Name: EventRenewed},
+			wantStatus:   StatusActive,
+			wantEnd:      active.PeriodEnd.Add(DefaultPeriod),
+			wantEntitled: true,
+		},
+		{
+			name:         "renewal after lapse starts now",
+			current:      lapsed,
+			event:        Event{Name: EventRenewed},
+			wantStatus:   StatusActive,
+			wantEnd:      now.Add(DefaultPeriod),
+			wantEntitled: true,
+		},
+		{
+			name:         "downgrade keeps access until period end",
+			current:      active,
+			event:        Event{Name: EventDowngraded},
+			wantStatus:   StatusCanceled,
+			wantEnd:      active.PeriodEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "payment failure keeps access until period end",
+			current:      active,
+			event:        Event{Name: EventPaymentFailed},
+			wantStatus:   StatusPastDue,
+			wantEnd:      active.PeriodEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "refund ends access immediately",
+			current:      active,
+			event:        Event{Name: EventRefunded},
+			wantStatus:   StatusRefunded,
+			wantEnd:      now,
+			wantEntitled: false,
+		},
+		{
+			name:    "downgrade without subscription",
+			current: nil,
+			event:   Event{Name: EventDowngraded},
+			wantErr: ErrNoSubscription,
+		},
+		{
+			name:    "unknown event",
+			current: active,
+			event:   Event{Name: "user.deleted"},
+			wantErr: ErrUnknownEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.current, tt.event, now)
+			if err != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("Apply() status = %q, want %q", got.Status, tt.wantStatus)
+			}
+			if !got.PeriodEnd.Equal(tt.wantEnd) {
+				t.Errorf("Apply() period end = %v, want %v", got.PeriodEnd, tt.wantEnd)
+			}
+			if got.Entitled(now) != tt.wantEntitled {
+				t.Errorf("Entitled() = %v, want %v", got.Entitled(now), tt.wantEntitled)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 6238 Appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists eight-digit codes; these are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current, _ := Code(rfcSecret, Step(now))
+	previous, _ := Code(rfcSecret, Step(now)-1)
+	stale, _ := Code(rfcSecret, Step(now)-3)
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{name: "current step", code: current, wantOK: true},
+		{name: "previous step within skew", code: previous, wantOK: true},
+		{name: "spaces are ignored", code: current[:3] + " " + current[3:], wantOK: true},
+		{name: "outside skew", code: stale, wantOK: false},
+		{name: "wrong length", code: "12345", wantOK: false},
+		{name: "empty", code: "", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.code, rfcSecret, now); ok != tt.wantOK {
+				t.Errorf("Validate() ok = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Chirpy", "user@example.com", "ABC")
+	for _, part := range []string{"otpauth://totp/Chirpy:user@example.com?", "secret=ABC", "issuer=Chirpy", "digits=6"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("URI() = %s, missing %s", uri, part)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package validate checks structs against rules declared in their validate
+// struct tags, such as `validate:"required,max=140"`. Fields are reported by
+// their JSON names, so errors can be shown against the request body.
+//
+// Rules:
+//
+//	required  the field is not empty; strings must contain more than spaces
+//	min=N     strings have at least N characters, slices N items, numbers are at least N
+//	max=N     strings have at most N characters, slices N items, numbers are at most N
+//	email     a bare address such as "user@example.com"
+//	oneof=a b the value is one of the space separated words
+//	uuid      the value is a UUID
+//
+// Rules other than required are skipped for empty fields, so optional fields
+// are only checked when present. Pointer fields are checked through the
+// pointer.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// FieldError is one rule a field broke. Code is stable and named after the
+// rule; Detail is for people.
+type FieldError struct {
+	Field  string
+	Code   string
+	Detail string
+}
+
+const (
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeInvalidEmail = "invalid_email"
+	CodeInvalidValue = "invalid_value"
+	CodeInvalidUUID  = "invalid_uuid"
+)
+
+// Struct returns every rule broken by v, which must be a struct or a pointer
+// to one. It panics on malformed tags, which are programming errors.
+func Struct(v any) []FieldError {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", v))
+	}
+	var errs []FieldError
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := jsonName(field)
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Pointer {
+			if fieldValue.IsNil() {
+				fieldValue = reflect.Value{}
+			} else {
+				fieldValue = fieldValue.Elem()
+			}
+		}
+		for rule := range strings.SplitSeq(tag, ",") {
+			if err, ok := check(name, rule, fieldValue); !ok {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// check reports whether value satisfies rule, and the error if not. An
+// invalid reflect.Value stands for a nil pointer.
+func check(name, rule string, value reflect.Value) (FieldError, bool) {
+	rule, arg, _ := strings.Cut(rule, "=")
+	if rule == "required" {
+		if isEmpty(value) {
+			return FieldError{Field: name, Code: CodeRequired, Detail: name + " is required"}, false
+		}
+		return FieldError{}, true
+	}
+	if isEmpty(value) {
+		return FieldError{}, true
+	}
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid %s rule %q for %s", rule, arg, name))
+		}
+		size, unit := measure(value)
+		if rule == "min" && size < limit {
+			return FieldError{Field: name, Code: CodeTooShort, Detail: fmt.Sprintf("%s must be at least %d%s", name, limit, unit)}, false
+		}
+		if rule == "max" && size > limit {
+			return FieldError{Field: name, Code: CodeTooLong, Detail: fmt.Sprintf("%s must be at most %d%s", name, limit, unit)}, false
+		}
+	case "email":
+		email := value.String()
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email || address.Name != "" {
+			return FieldError{Field: name, Code: CodeInvalidEmail, Detail: name + " must be an email address"}, false
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		if !slices.Contains(allowed, fmt.Sprint(value.Interface())) {
+			return FieldError{Field: name, Code: CodeInvalidValue, Detail: fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", "))}, false
+		}
+	case "uuid":
+		if _, err := uuid.Parse(value.String()); err != nil {
+			return FieldError{Field: name, Code: CodeInvalidUUID, Detail: name + " must be a UUID"}, false
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q for %s", rule, name))
+	}
+	return FieldError{}, true
+}
+
+func isEmpty(value reflect.Value) bool {
+	if !value.IsValid() {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// measure returns the size min and max compare against, and the unit to
+// name in messages.
+func measure(value reflect.Value) (int, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice, reflect.Map:
+		return value.Len(), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int()), ""
+	}
+	panic(fmt.Sprintf("validate: cannot measure %s", value.Kind()))
+}
@@ -0,0 +1,101 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type request struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password" validate:"required,min=8"`
+	Body     string   `json:"body" validate:"max=5"`
+	Status   string   `json:"status" validate:"oneof=open closed"`
+	ChirpID  *string  `json:"chirp_id" validate:"uuid"`
+	Scopes   []string `json:"scopes" validate:"required,max=2"`
+	Internal string   `validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := func() request {
+		return request{
+			Email:    "user@example.com",
+			Password: "long enough",
+			Scopes:   []string{"a"},
+			Internal: "x",
+		}
+	}
+	badID := "not-a-uuid"
+	tests := []struct {
+		name   string
+		modify func(*request)
+		want   []FieldError
+	}{
+		{
+			name:   "valid",
+			modify: func(*request) {},
+			want:   nil,
+		},
+		{
+			name:   "blank required string",
+			modify: func(r *request) { r.Email = "   " },
+			want:   []FieldError{{Field: "email", Code: CodeRequired, Detail: "email is required"}},
+		},
+		{
+			name:   "invalid email",
+			modify: func(r *request) { r.Email = "User <user@example.com>" },
+			want:   []FieldError{{Field: "email", Code: CodeInvalidEmail, Detail: "email must be an email address"}},
+		},
+		{
+			name:   "too short",
+			modify: func(r *request) { r.Password = "short" },
+			want:   []FieldError{{Field: "password", Code: CodeTooShort, Detail: "password must be at least 8 characters"}},
+		},
+		{
+			name:   "characters not bytes",
+			modify: func(r *request) { r.Body = "ééééé" },
+			want:   nil,
+		},
+		{
+			name:   "not one of",
+			modify: func(r *request) { r.Status = "pending" },
+			want:   []FieldError{{Field: "status", Code: CodeInvalidValue, Detail: "status must be one of open, closed"}},
+		},
+		{
+			name:   "invalid pointer uuid",
+			modify: func(r *request) { r.ChirpID = &badID },
+			want:   []FieldError{{Field: "chirp_id", Code: CodeInvalidUUID, Detail: "chirp_id must be a UUID"}},
+		},
+		{
+			name: "errors are aggregated",
+			modify: func(r *request) {
+				r.Scopes = []string{"a", "b", "c"}
+				r.Internal = ""
+			},
+			want: []FieldError{
+				{Field: "scopes", Code: CodeTooLong, Detail: "scopes must be at most 2 items"},
+				{Field: "Internal", Code: CodeRequired, Detail: "Internal is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			if got := Struct(&r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructPanicsOnUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Struct() did not panic on an unknown rule")
+		}
+	}()
+	Struct(struct {
+		Name string `validate:"requried"`
+	}{Name: "x"})
+}
@@ -0,0 +1,199 @@
+// Package webhooks delivers signed event payloads to URLs registered by users
+// and integrations, and decides when failed deliveries are retried.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+)
+
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpUpdated = "chirp.updated"
+	EventChirpDeleted = "chirp.deleted"
+)
+
+// Events lists the event names a webhook can subscribe to.
+var Events = map[string]bool{
+	EventChirpCreated: true,
+	EventChirpUpdated: true,
+	EventChirpDeleted: true,
+}
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+const (
+	// MaxAttempts is the number of failed attempts after which a delivery is
+	// moved to the dead-letter state.
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	// SendTimeout bounds one delivery attempt, including reading the
+	// response.
+	SendTimeout = 10 * time.Second
+)
+
+const (
+	SignatureHeader  = "Chirpy-Signature"
+	DeliveryIDHeader = "Chirpy-Delivery-Id"
+	EventHeader      = "Chirpy-Event"
+)
+
+// Backoff returns how long to wait before retrying after the given number of
+// failed attempts: 30s, 1m, 2m, ... capped at six hours.
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// Outcome is the state a delivery moves to after an attempt.
+type Outcome struct {
+	Status        string
+	NextAttemptAt time.Time
+}
+
+// Next decides what happens to a delivery that has now been attempted
+// attempts times (including the one just made).
+func Next(attempts int, delivered bool, now time.Time) Outcome {
+	if delivered {
+		return Outcome{Status: StatusDelivered, NextAttemptAt: now}
+	}
+	if attempts >= MaxAttempts {
+		return Outcome{Status: StatusDead, NextAttemptAt: now}
+	}
+	return Outcome{Status: StatusPending, NextAttemptAt: now.Add(Backoff(attempts))}
+}
+
+// Succeeded reports whether a receiver's status code acknowledges delivery.
+func Succeeded(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+// NewSecret returns a random signing secret for a new webhook.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+var (
+	ErrPrivateAddress = errors.New("receiver must be on a public network")
+	errRedirect       = errors.New("receiver responded with a redirect")
+)
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// CheckAddress returns ErrPrivateAddress for addresses that deliveries must
+// not reach: loopback, link-local (including cloud metadata services),
+// private and other non-public ranges.
+func CheckAddress(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// CheckHost resolves host and checks every address it resolves to, so that
+// a URL can be rejected when it is registered. Send checks the address again
+// when it connects, since DNS may change in between.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckAddress(addr)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("error resolving %s - %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := CheckAddress(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Sender struct {
+	Client *http.Client
+	// Now returns the time used to sign deliveries.
+	Now func() time.Time
+	// AllowPrivateNetworks lets deliveries reach addresses CheckAddress
+	// rejects, for receivers running next to a development server.
+	AllowPrivateNetworks bool
+}
+
+// NewSender returns a Sender that only connects to public addresses and does
+// not follow redirects, so a webhook URL cannot be used to reach internal
+// services.
+func NewSender() *Sender {
+	s := &Sender{Now: time.Now}
+	dialer := &net.Dialer{Timeout: SendTimeout, Control: s.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	s.Client = &http.Client{
+		Transport: transport,
+		Timeout:   SendTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+	return s
+}
+
+// checkDial runs after the host is resolved and before each connection is
+// made, so it sees the address actually dialed.
+func (s *Sender) checkDial(network, address string, _ syscall.RawConn) error {
+	if s.AllowPrivateNetworks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return CheckAddress(addrPort.Addr())
+}
+
+// Send makes one attempt to POST payload to url, signed with secret in the
+// same format Chirpy accepts from Polka. It returns the response status code.
+func (s *Sender) Send(ctx context.Context, url, secret, deliveryID, event string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request - %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryIDHeader, deliveryID)
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(SignatureHeader, auth.SignWebhook(payload, deliveryID, s.Now(), secret))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 7, want: 32 * time.Minute},
+		{attempts: 20, want: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		attempts  int
+		delivered bool
+		want      Outcome
+	}{
+		{
+			name:      "delivered",
+			attempts:  1,
+			delivered: true,
+			want:      Outcome{Status: StatusDelivered, NextAttemptAt: now},
+		},
+		{
+			name:     "first failure retries",
+			attempts: 1,
+			want:     Outcome{Status: StatusPending, NextAttemptAt: now.Add(30 * time.Second)},
+		},
+		{
+			name:     "last failure is dead-lettered",
+			attempts: MaxAttempts,
+			want:     Outcome{Status: StatusDead, NextAttemptAt: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Next(tt.attempts, tt.delivered, now); got != tt.want {
+				t.Errorf("Next() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus int
+	}{
+		{
+			name:       "receiver accepts signature",
+			secret:     "secret",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "receiver rejects other secret",
+			secret:     "other",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotEvent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				gotEvent = req.Header.Get(EventHeader)
+				err := auth.VerifyWebhookSignature(req.Header.Get(SignatureHeader), body, req.Header.Get(DeliveryIDHeader), []string{"secret"}, time.Minute, time.Now())
+				if err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			sender := NewSender()
+			sender.AllowPrivateNetworks = true
+			status, err := sender.Send(context.Background(), server.URL, tt.secret, "delivery-1", EventChirpCreated, []byte(`{"id":"1"}`))
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Send() status = %d, want %d", status, tt.wantStatus)
+			}
+			if gotEvent != EventChirpCreated {
+				t.Errorf("event header = %q, want %q", gotEvent, EventChirpCreated)
+			}
+		})
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "93.184.216.34", wantErr: false},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", wantErr: false},
+		{addr: "127.0.0.1", wantErr: true},
+		{addr: "::1", wantErr: true},
+		{addr: "169.254.169.254", wantErr: true},
+		{addr: "fe80::1", wantErr: true},
+		{addr: "10.1.2.3", wantErr: true},
+		{addr: "172.16.0.1", wantErr: true},
+		{addr: "192.168.1.1", wantErr: true},
+		{addr: "100.64.0.1", wantErr: true},
+		{addr: "fd00::1", wantErr: true},
+		{addr: "0.0.0.0", wantErr: true},
+		{addr: "::ffff:127.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := CheckAddress(netip.MustParseAddr(tt.addr)); (err != nil) != tt.wantErr {
+			t.Errorf("CheckAddress(%s) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSendRefusesInternalReceivers(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, "/internal", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if _, err := NewSender().Send(context.Background(), server.URL, "secret", "delivery-1", EventChirpCreated, nil); err == nil {
+		t.Errorf("Send() to a loopback address succeeded")
+	}
+	if requests != 0 {
+		t.Errorf("loopback receiver got %d requests, want 0", requests)
+	}
+
+	sender := NewSender()
+	sender.AllowPrivateNetworks = true
+	if _, err := sender.Send(context.Background(), server.URL+"/redirect", "secret", "delivery-1", EventChirpCreated, nil); err == nil {
+		t.Errorf("Send() followed a redirect")
+	}
+	if requests != 1 {
+		t.Errorf("receiver got %d requests, want only the redirecting one", requests)
+	}
+}
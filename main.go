@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"sort"
 	"strings"
@@ -17,36 +19,59 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/panaiotuzunov/Chirpy/internal/auth"
 	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/entitlements"
+	"github.com/panaiotuzunov/Chirpy/internal/mailer"
+	"github.com/panaiotuzunov/Chirpy/internal/oidc"
+	"github.com/panaiotuzunov/Chirpy/internal/ratelimit"
+	"github.com/panaiotuzunov/Chirpy/internal/webhooks"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	conn           *sql.DB
 	platform       string
 	secret         string
-	polkaKey       string
-}
-type errorResponse struct {
-	Error string `json:"error"`
+	polkaKeys      []string
+	webhookSender  *webhooks.Sender
+	mailer         mailer.Mailer
+	publicURL      string
+	totpSecrets    *auth.SecretBox
+	oidc           *oidc.RelyingParty
+	rateLimiter    ratelimit.Store
+	trustedProxies []netip.Prefix
+
+	idempotencyKeyTTL time.Duration
+
+	passwordHasher    *auth.PasswordHasher
+	passwordPolicy    *auth.PasswordPolicy
+	dummyPasswordHash string
+
+	filterMessageProfanity bool
+	deletionGracePeriod    time.Duration
+	blockUnverifiedPosting bool
 }
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Role          string    `json:"role"`
 }
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
 }
 
-const maxChirpLength int = 140
 const accessTokenExpiration = time.Hour
 const refreshTokenExpiration = time.Hour * 60 * 24
 
@@ -66,12 +91,12 @@ func (cfg *apiConfig) ReturnMetrics(writer http.ResponseWriter, req *http.Reques
 
 func (cfg *apiConfig) Reset(writer http.ResponseWriter, req *http.Request) {
 	if cfg.platform != "dev" {
-		writeErrorResponse(writer, http.StatusForbidden, "Forbidden")
+		writeErrorResponse(writer, req, http.StatusForbidden, "Forbidden")
 		return
 	}
 	if err := cfg.db.DeleteUsers(req.Context()); err != nil {
 		log.Printf("Error deleting users - %v", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Reset failed")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
 	cfg.fileserverHits.Store(0)
@@ -86,172 +111,334 @@ func handlerHealthz(writer http.ResponseWriter, req *http.Request) {
 	writer.Write([]byte("OK"))
 }
 
+type createUserRequest struct {
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+}
+
 func (cfg *apiConfig) handlerCreateUser(writer http.ResponseWriter, req *http.Request) {
-	var requestData struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+	var requestData createUserRequest
+	if !decodeJSON(writer, req, &requestData) {
+		return
 	}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&requestData); err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error decoding JSON")
+	fieldErrors := validateRequest(&requestData)
+	if requestData.Password != "" {
+		if err := cfg.passwordPolicy.Check(requestData.Password, requestData.Email); err != nil {
+			fieldErrors = append(fieldErrors, invalidField("password", errorDetail(err)))
+		}
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationError(writer, req, fieldErrors...)
 		return
 	}
-	hashedPassword, err := auth.HashPassword(requestData.Password)
+	hashedPassword, err := cfg.passwordHasher.Hash(requestData.Password)
 	if err != nil {
 		log.Printf("Error hashing password - %v", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error creating user.")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
 	params := database.CreateUserParams{Email: requestData.Email, HashedPassword: hashedPassword}
 	userResult, err := cfg.db.CreateUser(req.Context(), params)
 	if err != nil {
 		log.Printf("Error creating user - %v", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error creating user.")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	writeJSONResponse(writer, http.StatusCreated, User{
-		ID:          userResult.ID,
-		CreatedAt:   userResult.CreatedAt,
-		UpdatedAt:   userResult.UpdatedAt,
-		Email:       userResult.Email,
-		IsChirpyRed: userResult.IsChirpyRed})
+	if err := cfg.sendEmailVerification(req.Context(), userResult.ID, userResult.Email); err != nil {
+		log.Printf("Error sending email verification: %s", err)
+	}
+	writeJSONResponse(writer, http.StatusCreated, userFromDB(userResult))
+}
+
+type loginRequest struct {
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required"`
 }
 
 func (cfg *apiConfig) handlerLogin(writer http.ResponseWriter, req *http.Request) {
-	var requestData struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+	var requestData loginRequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
 	}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&requestData); err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error decoding JSON")
+	accountKey := accountLoginKey(requestData.Email)
+	if !cfg.checkLoginLockout(writer, req, accountKey) {
 		return
 	}
 	user, err := cfg.db.GetUserByEmail(req.Context(), requestData.Email)
 	if err != nil {
-		log.Printf("Error getting user from DB: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Incorrect email or password")
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		cfg.passwordHasher.Verify(requestData.Password, cfg.dummyPasswordHash)
+		cfg.rejectLogin(writer, req, accountKey, loginFailedMessage)
+		return
+	}
+	needsRehash, err := cfg.passwordHasher.Verify(requestData.Password, user.HashedPassword)
+	if err != nil {
+		cfg.rejectLogin(writer, req, accountKey, loginFailedMessage)
+		return
+	}
+	if needsRehash {
+		cfg.rehashPassword(req.Context(), user.ID, requestData.Password)
+	}
+	if err := accountStatusError(user); err != nil {
+		writeCodedErrorResponse(writer, req, http.StatusForbidden, codeAccountUnavailable, errorDetail(err))
 		return
 	}
-	if err := auth.CheckPasswordHash(requestData.Password, user.HashedPassword); err != nil {
-		writeErrorResponse(writer, http.StatusUnauthorized, "incorrect email or password")
+	if user.TotpEnabledAt.Valid {
+		mfaToken, err := auth.MakeMFAChallengeToken(user.ID, cfg.secret, mfaChallengeExpiration)
+		if err != nil {
+			log.Printf("Error creating MFA challenge token: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		writeJSONResponse(writer, http.StatusOK, MFAChallenge{MFARequired: true, MFAToken: mfaToken})
 		return
 	}
-	token, err := auth.MakeJWT(user.ID, cfg.secret, accessTokenExpiration)
+	cfg.clearLoginFailures(req.Context(), accountKey)
+	result, err := cfg.issueTokens(req, user)
 	if err != nil {
-		log.Printf("Error creating token: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Server Error.")
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// issueTokens creates an access token and a refresh token for a user who has
+// completed login. The refresh token starts a new session recording the
+// client's user agent and IP address.
+func (cfg *apiConfig) issueTokens(req *http.Request, user database.User) (User, error) {
+	token, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.secret, accessTokenExpiration)
+	if err != nil {
+		return User{}, err
+	}
 	refreshTokenString, err := auth.MakeRefreshToken()
 	if err != nil {
-		fmt.Printf("Error creating token: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Server Error.")
-		return
+		return User{}, err
 	}
 	refreshToken, err := cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
 		Token:     refreshTokenString,
 		UserID:    user.ID,
 		ExpiresAt: time.Now().Add(refreshTokenExpiration),
+		UserAgent: req.UserAgent(),
+		IpAddress: cfg.clientIP(req),
 	})
 	if err != nil {
-		log.Printf("Error creating refresh token in DB: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "DB Server Error.")
-		return
+		return User{}, err
 	}
-	writeJSONResponse(writer, http.StatusOK, User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshToken.Token,
-		IsChirpyRed:  user.IsChirpyRed,
-	})
+	result := userFromDB(user)
+	result.Token = token
+	result.RefreshToken = refreshToken.Token
+	return result, nil
+}
+
+type addChirpRequest struct {
+	Body      string     `json:"body" validate:"required"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (cfg *apiConfig) handlerAddChirp(writer http.ResponseWriter, req *http.Request) {
-	var requestData struct {
-		Body string `json:"body"`
-	}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&requestData); err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error decoding JSON")
-		return
-	}
-	if len(requestData.Body) > maxChirpLength {
-		writeErrorResponse(writer, http.StatusBadRequest, "Chirp is too long")
+	var requestData addChirpRequest
+	if !decodeRequest(writer, req, &requestData) {
 		return
 	}
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
 		log.Printf("Error getting token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Unauthorized")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	id, err := auth.ValidateJWT(token, cfg.secret)
+	id, err := cfg.validateAccessToken(req.Context(), token)
 	if err != nil {
 		log.Printf("Error validating token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, id)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(writer, req, user) {
+		return
+	}
+	userEntitlements := entitlements.For(user.IsChirpyRed)
+	if err := userEntitlements.CheckChirpBody(requestData.Body); err != nil {
+		writeValidationError(writer, req, invalidField("body", errorDetail(err)))
 		return
 	}
-	chirp, err := cfg.db.CreateChirp(req.Context(), database.CreateChirpParams{Body: hideProfanity(requestData.Body), UserID: id})
+	params := database.CreateChirpParams{Body: hideProfanity(requestData.Body), UserID: id}
+	if requestData.PublishAt != nil {
+		if err := userEntitlements.CheckSchedule(*requestData.PublishAt, time.Now()); err != nil {
+			if err == entitlements.ErrSchedulingNotAllowed {
+				writeErrorResponse(writer, req, http.StatusForbidden, errorDetail(err))
+				return
+			}
+			writeValidationError(writer, req, invalidField("publish_at", errorDetail(err)))
+			return
+		}
+		params.PublishAt = sql.NullTime{Time: requestData.PublishAt.UTC(), Valid: true}
+	}
+	chirp, err := cfg.db.CreateChirp(req.Context(), params)
 	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error creating chirp")
+		log.Printf("Error creating chirp: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	writeJSONResponse(writer, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID})
+	// Scheduled chirps are announced by announceScheduledChirps once they
+	// are published, so integrations never see a chirp early.
+	if !chirp.PublishAt.Valid {
+		cfg.enqueueWebhookEvent(req.Context(), id, webhooks.EventChirpCreated, chirpFromDB(chirp))
+	}
+	writeJSONResponse(writer, http.StatusCreated, chirpFromDB(chirp))
 }
 
-func (cfg *apiConfig) handlerChirps(writer http.ResponseWriter, req *http.Request) {
-	authorQuery := req.URL.Query().Get("author_id")
-	sortQuery := req.URL.Query().Get("sort")
-	var resultChirps []Chirp
-	if authorQuery == "" {
-		chirps, err := cfg.db.GetChirps(req.Context())
-		if err != nil {
-			log.Printf("Error getting chirps from DB: %s", err)
-			writeErrorResponse(writer, http.StatusInternalServerError, "Error getting chirps")
+type editChirpRequest struct {
+	Body string `json:"body" validate:"required"`
+}
+
+func (cfg *apiConfig) handlerEditChirp(writer http.ResponseWriter, req *http.Request) {
+	var requestData editChirpRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(writer, req, user) {
+		return
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("Error parsing chirpID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	userEntitlements := entitlements.For(user.IsChirpyRed)
+	if err := userEntitlements.CheckEdit(); err != nil {
+		writeErrorResponse(writer, req, http.StatusForbidden, errorDetail(err))
+		return
+	}
+	if err := userEntitlements.CheckChirpBody(requestData.Body); err != nil {
+		writeValidationError(writer, req, invalidField("body", errorDetail(err)))
+		return
+	}
+	chirp, err := cfg.db.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "No chirp found")
 			return
 		}
-		for _, chirp := range chirps {
-			resultChirps = append(resultChirps, Chirp{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID})
-		}
-		if sortQuery == "desc" {
-			sort.Slice(resultChirps, func(i, j int) bool {
-				return resultChirps[i].CreatedAt.After(resultChirps[j].CreatedAt)
-			})
-		}
-		writeJSONResponse(writer, http.StatusOK, resultChirps)
+		log.Printf("Error getting chirp from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if chirp.UserID != userID {
+		writeErrorResponse(writer, req, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if chirp.HiddenAt.Valid {
+		writeErrorResponse(writer, req, http.StatusForbidden, "Chirp has been hidden by a moderator")
 		return
 	}
-	authorID, err := uuid.Parse(authorQuery)
+	chirp, err = cfg.db.UpdateChirpBody(req.Context(), database.UpdateChirpBodyParams{
+		Body: hideProfanity(requestData.Body),
+		ID:   chirpID,
+	})
+	if err != nil {
+		log.Printf("Error updating chirp: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if chirpFromDB(chirp).publishedAt().Before(time.Now()) {
+		cfg.enqueueWebhookEvent(req.Context(), userID, webhooks.EventChirpUpdated, chirpFromDB(chirp))
+	}
+	writeJSONResponse(writer, http.StatusOK, chirpFromDB(chirp))
+}
+
+func (cfg *apiConfig) handlerScheduledChirps(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
 	if err != nil {
-		log.Printf("Error parsing uuid from query: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid author_id query")
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
 		return
 	}
-	chirps, err := cfg.db.GetChirpsByAuthor(req.Context(), authorID)
+	chirps, err := cfg.db.GetScheduledChirpsByAuthor(req.Context(), userID)
 	if err != nil {
 		log.Printf("Error getting chirps from DB: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error getting chirps")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
+	resultChirps := []Chirp{}
 	for _, chirp := range chirps {
-		resultChirps = append(resultChirps, Chirp{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID})
+		resultChirps = append(resultChirps, chirpFromDB(chirp))
+	}
+	writeJSONResponse(writer, http.StatusOK, resultChirps)
+}
+
+// chirpsQuery is the query string of GET /api/chirps.
+type chirpsQuery struct {
+	AuthorID string `json:"author_id" validate:"uuid"`
+	Sort     string `json:"sort" validate:"oneof=asc desc"`
+}
+
+func (cfg *apiConfig) handlerChirps(writer http.ResponseWriter, req *http.Request) {
+	var query chirpsQuery
+	if !decodeQuery(writer, req, &query) {
+		return
+	}
+	hiddenAuthors := map[uuid.UUID]struct{}{}
+	if req.Header.Get("Authorization") != "" {
+		viewerID, err := cfg.authenticatedUserID(req)
+		if err != nil {
+			log.Printf("Error authenticating request: %s", err)
+			writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		hiddenAuthors, err = cfg.hiddenAuthorIDs(req, viewerID)
+		if err != nil {
+			log.Printf("Error getting hidden authors from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
 	}
-	if sortQuery == "desc" {
+	var chirps []database.Chirp
+	if query.AuthorID == "" {
+		var err error
+		chirps, err = cfg.db.GetChirps(req.Context())
+		if err != nil {
+			log.Printf("Error getting chirps from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	} else {
+		var err error
+		chirps, err = cfg.db.GetChirpsByAuthor(req.Context(), uuid.MustParse(query.AuthorID))
+		if err != nil {
+			log.Printf("Error getting chirps from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	var resultChirps []Chirp
+	for _, chirp := range chirps {
+		if _, hidden := hiddenAuthors[chirp.UserID]; hidden {
+			continue
+		}
+		resultChirps = append(resultChirps, chirpFromDB(chirp))
+	}
+	if query.Sort == "desc" {
 		sort.Slice(resultChirps, func(i, j int) bool {
-			return resultChirps[i].CreatedAt.After(resultChirps[j].CreatedAt)
+			return resultChirps[i].publishedAt().After(resultChirps[j].publishedAt())
 		})
 	}
 	writeJSONResponse(writer, http.StatusOK, resultChirps)
@@ -261,54 +448,71 @@ func (cfg *apiConfig) handlerGetChirp(writer http.ResponseWriter, req *http.Requ
 	id, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
 		log.Printf("Error parsing chirpID argument: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid ID")
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 	chirp, err := cfg.db.GetChirpByID(req.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			writeErrorResponse(writer, http.StatusNotFound, "Not found")
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
 			return
 		}
 		log.Printf("Error getting chirp from DB: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error getting chirp")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	writeJSONResponse(writer, http.StatusOK, Chirp{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID})
+	if chirp.HiddenAt.Valid || (chirp.PublishAt.Valid && chirp.PublishAt.Time.After(time.Now())) {
+		writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, chirpFromDB(chirp))
+}
+
+// AccessToken is a new access token issued for a refresh token.
+type AccessToken struct {
+	Token string `json:"token"`
 }
 
 func (cfg *apiConfig) handlerRefresh(writer http.ResponseWriter, req *http.Request) {
 	tokenString, err := auth.GetBearerToken(req.Header)
 	if err != nil {
 		log.Printf("Error getting bearer token: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid header")
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid header")
 		return
 	}
 	refreshToken, err := cfg.db.GetUserFromRefreshToken(req.Context(), tokenString)
 	if err != nil {
 		log.Printf("Error getting user from refresh token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 	if time.Now().After(refreshToken.ExpiresAt) {
 		log.Println("Refresh token expired")
-		writeErrorResponse(writer, http.StatusUnauthorized, "Token expired.")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Token expired.")
 		return
 	}
 	if refreshToken.RevokedAt.Valid {
 		log.Println("Refresh token revoked")
-		writeErrorResponse(writer, http.StatusUnauthorized, "Token revoked.")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Token revoked.")
 		return
 	}
-	jwt, err := auth.MakeJWT(refreshToken.UserID, cfg.secret, accessTokenExpiration)
+	user, ok := cfg.requireActiveAccount(writer, req, refreshToken.UserID)
+	if !ok {
+		return
+	}
+	jwt, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.secret, accessTokenExpiration)
 	if err != nil {
 		log.Printf("Error creating JWT - %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Server error")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	writeJSONResponse(writer, http.StatusOK, struct {
-		Token string `json:"token"`
-	}{
+	if err := cfg.db.TouchRefreshToken(req.Context(), database.TouchRefreshTokenParams{
+		Token:     refreshToken.Token,
+		IpAddress: cfg.clientIP(req),
+	}); err != nil {
+		log.Printf("Error updating session: %s", err)
+	}
+	writeJSONResponse(writer, http.StatusOK, AccessToken{
 		Token: jwt,
 	})
 }
@@ -317,143 +521,200 @@ func (cfg *apiConfig) handlerRevoke(writer http.ResponseWriter, req *http.Reques
 	tokenString, err := auth.GetBearerToken(req.Header)
 	if err != nil {
 		log.Printf("Error getting bearer token: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid header")
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid header")
 		return
 	}
 	if err := cfg.db.RevokeRefreshToken(req.Context(), tokenString); err != nil {
 		log.Printf("Error revoking token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 	writer.WriteHeader(http.StatusNoContent)
 }
 
+type updateCredentialsRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
 func (cfg *apiConfig) handlerUpdateCredentials(writer http.ResponseWriter, req *http.Request) {
-	var requestData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var requestData updateCredentialsRequest
 	tokenString, err := auth.GetBearerToken(req.Header)
 	if err != nil {
 		log.Printf("Error getting bearer token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Missing or invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
 		return
 	}
-	userID, err := auth.ValidateJWT(tokenString, cfg.secret)
+	userID, err := cfg.validateAccessToken(req.Context(), tokenString)
 	if err != nil {
 		log.Printf("Error validating access token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Missing or invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
 		return
 	}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&requestData); err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Error decoding JSON")
+	changingEmail := requestData.Email != user.Email && requestData.Email != user.PendingEmail.String
+	if changingEmail {
+		_, err := cfg.db.GetUserByEmail(req.Context(), requestData.Email)
+		if err == nil {
+			writeErrorResponse(writer, req, http.StatusConflict, errorDetail(errEmailAlreadyInUse))
+			return
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	if err := cfg.passwordPolicy.Check(requestData.Password, requestData.Email); err != nil {
+		writeValidationError(writer, req, invalidField("password", errorDetail(err)))
 		return
 	}
-	hashedPassword, err := auth.HashPassword(requestData.Password)
+	hashedPassword, err := cfg.passwordHasher.Hash(requestData.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Server error")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	user, err := cfg.db.UpdateCredentials(req.Context(), database.UpdateCredentialsParams{
-		Email:          requestData.Email,
+	// A new email only becomes pending. The current address keeps working
+	// until the new one is confirmed through handlerVerifyEmail.
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	if _, err := qtx.UpdateCredentials(req.Context(), database.UpdateCredentialsParams{
+		Email:          user.Email,
 		HashedPassword: hashedPassword,
 		ID:             userID,
-	})
-	if err != nil {
+	}); err != nil {
 		log.Printf("Error updating credentials: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "DB Server error")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
-	writeJSONResponse(writer, http.StatusOK, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		Token:       tokenString,
-		IsChirpyRed: user.IsChirpyRed,
-	})
+	// Sending the current address again cancels a pending change.
+	if changingEmail || (requestData.Email == user.Email && user.PendingEmail.Valid) {
+		pendingEmail := sql.NullString{}
+		if changingEmail {
+			pendingEmail = sql.NullString{String: requestData.Email, Valid: true}
+		}
+		if err := qtx.SetPendingEmail(req.Context(), database.SetPendingEmailParams{
+			PendingEmail: pendingEmail,
+			ID:           userID,
+		}); err != nil {
+			log.Printf("Error setting pending email: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	// Every other session was signed in with the old password, so it ends
+	// here and the caller gets a fresh pair of tokens below.
+	if err := revokeAllTokens(req.Context(), qtx, userID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	user, err = qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if changingEmail {
+		if err := cfg.sendEmailVerification(req.Context(), userID, requestData.Email); err != nil {
+			log.Printf("Error sending email verification: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	result, err := cfg.issueTokens(req, user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(writer http.ResponseWriter, req *http.Request) {
 	tokenString, err := auth.GetBearerToken(req.Header)
 	if err != nil {
 		log.Printf("Error getting bearer token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Missing or invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
 		return
 	}
-	userID, err := auth.ValidateJWT(tokenString, cfg.secret)
+	userID, err := cfg.validateAccessToken(req.Context(), tokenString)
 	if err != nil {
 		log.Printf("Error validating access token: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Missing or invalid token")
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
 		return
 	}
 	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
 		log.Printf("Error parsing chirpID argument: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid ID")
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 	chirp, err := cfg.db.GetChirpByID(req.Context(), chirpID)
 	if err != nil {
 		log.Printf("Chirp not found: %s", err)
-		writeErrorResponse(writer, http.StatusNotFound, "No chirp found")
+		writeErrorResponse(writer, req, http.StatusNotFound, "No chirp found")
 		return
 	}
 	if chirp.UserID != userID {
-		writeErrorResponse(writer, http.StatusForbidden, "Forbidden")
+		writeErrorResponse(writer, req, http.StatusForbidden, "Forbidden")
 		return
 	}
 	if err := cfg.db.DeleteChirp(req.Context(), chirpID); err != nil {
 		log.Printf("Error deleting chirp: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Error deleting chirp")
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
 		return
 	}
+	if chirpFromDB(chirp).publishedAt().Before(time.Now()) {
+		cfg.enqueueWebhookEvent(req.Context(), userID, webhooks.EventChirpDeleted, chirpFromDB(chirp))
+	}
 	writer.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) handlerUpgradeUserToChirpyRed(writer http.ResponseWriter, req *http.Request) {
-	var requestData struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
-	}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&requestData); err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Error decoding JSON")
-		return
-	}
-	apiKey, err := auth.GetAPIKey(req.Header)
-	if err != nil || apiKey != cfg.polkaKey {
-		log.Printf("Error parsing API key: %s", err)
-		writeErrorResponse(writer, http.StatusUnauthorized, "Invalid API Key")
-		return
-	}
-	if requestData.Event != "user.upgraded" {
-		writer.WriteHeader(http.StatusNoContent)
-		return
-	}
-	id, err := uuid.Parse(requestData.Data.UserID)
+// authenticatedUserID returns the ID of the user whose access token is sent in
+// the Authorization header.
+func (cfg *apiConfig) authenticatedUserID(req *http.Request) (uuid.UUID, error) {
+	tokenString, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error parsing chirpID argument: %s", err)
-		writeErrorResponse(writer, http.StatusBadRequest, "Invalid ID")
-		return
+		return uuid.UUID{}, err
 	}
-	_, err = cfg.db.UpgradeUserToChirpyRed(req.Context(), id)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			writeErrorResponse(writer, http.StatusNotFound, "User not found")
-			return
+	return cfg.validateAccessToken(req.Context(), tokenString)
+}
+
+// validateAccessToken checks an access token and that it was issued after the
+// user last logged out everywhere. Scoped tokens are only accepted once
+// middlewareRequireScope has checked them for the route.
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, tokenString string) (uuid.UUID, error) {
+	if isScopedToken(tokenString) {
+		userID, ok := ctx.Value(scopedTokenUserContextKey).(uuid.UUID)
+		if !ok {
+			return uuid.UUID{}, errScopedTokenNotAllowed
 		}
-		log.Printf("Error running sql query: %s", err)
-		writeErrorResponse(writer, http.StatusInternalServerError, "DB Server error")
-		return
+		return userID, nil
 	}
-	writer.WriteHeader(http.StatusNoContent)
+	return auth.ValidateJWT(tokenString, cfg.secret, func(userID uuid.UUID) (int32, error) {
+		return cfg.db.GetUserTokenVersion(ctx, userID)
+	})
 }
 
 func writeJSONResponse(w http.ResponseWriter, statusCode int, data any) {
@@ -468,8 +729,41 @@ func writeJSONResponse(w http.ResponseWriter, statusCode int, data any) {
 	}
 	w.Write(jsonData)
 }
-func writeErrorResponse(w http.ResponseWriter, statusCode int, text string) {
-	writeJSONResponse(w, statusCode, errorResponse{Error: text})
+
+func userFromDB(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+	}
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	result := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+	if chirp.PublishAt.Valid {
+		result.PublishAt = &chirp.PublishAt.Time
+	}
+	return result
+}
+
+// publishedAt is when the chirp became visible; scheduled chirps are ordered
+// by their publish time rather than when they were written.
+func (c Chirp) publishedAt() time.Time {
+	if c.PublishAt != nil {
+		return *c.PublishAt
+	}
+	return c.CreatedAt
 }
 
 func hideProfanity(chirp string) string {
@@ -491,37 +785,109 @@ func hideProfanity(chirp string) string {
 	return strings.Join(resultSlice, " ")
 }
 
+// polkaKeys returns the Polka signing keys from POLKA_KEYS, a comma separated
+// list used while rotating keys, falling back to the single POLKA_KEY.
+func polkaKeys() []string {
+	var keys []string
+	for key := range strings.SplitSeq(os.Getenv("POLKA_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 && os.Getenv("POLKA_KEY") != "" {
+		keys = append(keys, os.Getenv("POLKA_KEY"))
+	}
+	return keys
+}
+
 func main() {
 	godotenv.Load(".env")
+	var deletionGracePeriod time.Duration
+	if value := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); value != "" {
+		var err error
+		deletionGracePeriod, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_PERIOD - %v", err)
+		}
+	}
+	passwordHasher, err := newPasswordHasher()
+	if err != nil {
+		log.Fatalf("Invalid password hashing parameters - %v", err)
+	}
+	passwordPolicy, err := newPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy - %v", err)
+	}
+	// Unknown emails are checked against this hash so that they take as long
+	// as a wrong password for a real account.
+	dummyPasswordHash, err := passwordHasher.Hash("chirpy-dummy-password")
+	if err != nil {
+		log.Fatalf("Error hashing dummy password - %v", err)
+	}
+	idempotencyKeyTTL, err := newIdempotencyKeyTTL()
+	if err != nil {
+		log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL - %v", err)
+	}
+	trustedProxies, err := newTrustedProxies()
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES - %v", err)
+	}
+	mailSender, err := newMailer(os.Getenv("PLATFORM"))
+	if err != nil {
+		log.Fatalf("Error configuring mailer - %v", err)
+	}
+	totpSecrets, err := newTOTPSecretBox(os.Getenv("PLATFORM"), os.Getenv("SECRET"))
+	if err != nil {
+		log.Fatalf("Error configuring TOTP secret encryption - %v", err)
+	}
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
 	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
 	if err != nil {
 		log.Fatalf("Error connecting to DB - %v", err)
 	}
 	cfg := apiConfig{
-		db:       database.New(db),
-		platform: os.Getenv("PLATFORM"),
-		secret:   os.Getenv("SECRET"),
-		polkaKey: os.Getenv("POLKA_KEY"),
+		db:             database.New(db),
+		conn:           db,
+		platform:       os.Getenv("PLATFORM"),
+		secret:         os.Getenv("SECRET"),
+		polkaKeys:      polkaKeys(),
+		webhookSender:  webhooks.NewSender(),
+		mailer:         mailSender,
+		publicURL:      publicURL,
+		totpSecrets:    totpSecrets,
+		oidc:           newOIDCRelyingParty(publicURL),
+		rateLimiter:    ratelimit.NewMemoryStore(),
+		trustedProxies: trustedProxies,
+
+		idempotencyKeyTTL: idempotencyKeyTTL,
+
+		passwordHasher:    passwordHasher,
+		passwordPolicy:    passwordPolicy,
+		dummyPasswordHash: dummyPasswordHash,
+
+		filterMessageProfanity: os.Getenv("FILTER_MESSAGE_PROFANITY") == "true",
+		deletionGracePeriod:    deletionGracePeriod,
+		blockUnverifiedPosting: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
 	}
+	cfg.webhookSender.AllowPrivateNetworks = cfg.platform == "dev"
 	mux := http.NewServeMux()
 	server := http.Server{
 		Handler: mux,
 		Addr:    ":8080",
 	}
-	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir("./")))))
-	mux.HandleFunc("GET /admin/metrics", cfg.ReturnMetrics)
-	mux.HandleFunc("POST /admin/reset", cfg.Reset)
-	mux.HandleFunc("GET /api/healthz", handlerHealthz)
-	mux.HandleFunc("GET /api/chirps", cfg.handlerChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
-	mux.HandleFunc("POST /api/chirps", cfg.handlerAddChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
-	mux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", cfg.handlerUpdateCredentials)
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
-	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerUpgradeUserToChirpyRed)
+	for _, route := range cfg.routes() {
+		mux.Handle(route.pattern, route.handler)
+	}
+	go cfg.expireLapsedSubscriptions(subscriptionExpiryInterval)
+	go cfg.deliverWebhooks(webhookDeliveryInterval)
+	go cfg.cleanupLoginFailures(loginFailureCleanup)
+	go cfg.cleanupIdempotencyKeys(idempotencyKeyCleanup)
+	if cfg.deletionGracePeriod > 0 {
+		go cfg.purgeDeletedUsers(purgeDeletedUsersInterval)
+	}
 	log.Print("Server is running")
 	server.ListenAndServe()
 }
@@ -0,0 +1,1869 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/panaiotuzunov/Chirpy/client"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/entitlements"
+	"github.com/panaiotuzunov/Chirpy/internal/idpsim"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+	"github.com/panaiotuzunov/Chirpy/internal/oidc"
+	"github.com/panaiotuzunov/Chirpy/internal/polkasim"
+	"github.com/panaiotuzunov/Chirpy/internal/ratelimit"
+	"github.com/panaiotuzunov/Chirpy/internal/scopes"
+	"github.com/panaiotuzunov/Chirpy/internal/totp"
+	"github.com/panaiotuzunov/Chirpy/internal/webhooks"
+)
+
+// newTestConfig connects to the database in CHIRPY_TEST_DB_URL, which must
+// already be migrated, and skips the test when it is not set.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Error connecting to DB - %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	totpSecrets, err := auth.NewSecretBox(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("Error creating secret box - %v", err)
+	}
+	// Test receivers listen on loopback.
+	webhookSender := webhooks.NewSender()
+	webhookSender.AllowPrivateNetworks = true
+	return &apiConfig{
+		db:        database.New(db),
+		conn:      db,
+		platform:  "dev",
+		secret:    "test-secret",
+		polkaKeys: []string{"test-polka-key"},
+
+		webhookSender: webhookSender,
+
+		totpSecrets:    totpSecrets,
+		passwordHasher: auth.NewPasswordHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}),
+		passwordPolicy: auth.NewPasswordPolicy(defaultPasswordMinLength, maxPasswordLength),
+	}
+}
+
+func createTestUser(t *testing.T, cfg *apiConfig) database.User {
+	t.Helper()
+	user, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          uuid.NewString() + "@example.com",
+		HashedPassword: "unset",
+	})
+	if err != nil {
+		t.Fatalf("Error creating user - %v", err)
+	}
+	t.Cleanup(func() { cfg.db.DeleteUser(context.Background(), user.ID) })
+	return user
+}
+
+// setTestPassword gives user a password they can log in with.
+func setTestPassword(t *testing.T, cfg *apiConfig, user database.User, password string) {
+	t.Helper()
+	hashedPassword, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Error hashing password - %v", err)
+	}
+	if err := cfg.db.UpdateUserPassword(context.Background(), database.UpdateUserPasswordParams{HashedPassword: hashedPassword, ID: user.ID}); err != nil {
+		t.Fatalf("Error setting password - %v", err)
+	}
+}
+
+// testJWT returns an access token for user.
+func testJWT(t *testing.T, cfg *apiConfig, user database.User) string {
+	t.Helper()
+	jwt, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.secret, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating JWT - %v", err)
+	}
+	return jwt
+}
+
+// serveTestRequest sends body as JSON to handler with bearer as the access
+// token, decodes the response into out unless it is nil and returns the
+// status code.
+func serveTestRequest(t *testing.T, handler http.Handler, method, path, bearer string, body, out any) int {
+	t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Error encoding request - %v", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("Error decoding %s %s response - %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestConversationsIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/conversations", cfg.handlerStartConversation)
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", cfg.handlerMessages)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", cfg.handlerSendMessage)
+	alice, bob, eve := createTestUser(t, cfg), createTestUser(t, cfg), createTestUser(t, cfg)
+
+	var conversation Conversation
+	start := map[string]string{"recipient_id": bob.ID.String()}
+	if status := serveTestRequest(t, mux, "POST", "/api/conversations", testJWT(t, cfg, alice), start, &conversation); status != http.StatusCreated {
+		t.Fatalf("start conversation status = %d, want 201", status)
+	}
+	var again Conversation
+	start = map[string]string{"recipient_id": alice.ID.String()}
+	if status := serveTestRequest(t, mux, "POST", "/api/conversations", testJWT(t, cfg, bob), start, &again); status != http.StatusOK || again.ID != conversation.ID {
+		t.Errorf("start the same conversation = %d %s, want 200 %s", status, again.ID, conversation.ID)
+	}
+	messagesPath := "/api/conversations/" + conversation.ID.String() + "/messages"
+	if status := serveTestRequest(t, mux, "POST", messagesPath, testJWT(t, cfg, alice), map[string]string{"body": "hi bob"}, nil); status != http.StatusCreated {
+		t.Fatalf("send message status = %d, want 201", status)
+	}
+
+	tests := []struct {
+		name       string
+		user       database.User
+		method     string
+		wantStatus int
+	}{
+		{name: "participant reads", user: bob, method: "GET", wantStatus: http.StatusOK},
+		{name: "other user reads", user: eve, method: "GET", wantStatus: http.StatusNotFound},
+		{name: "other user sends", user: eve, method: "POST", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body any
+			if tt.method == "POST" {
+				body = map[string]string{"body": "hello"}
+			}
+			if status := serveTestRequest(t, mux, tt.method, messagesPath, testJWT(t, cfg, tt.user), body, nil); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBlocksIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps", cfg.handlerChirps)
+	mux.HandleFunc("POST /api/conversations", cfg.handlerStartConversation)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", cfg.handlerSendMessage)
+	mux.HandleFunc("POST /api/users/{userID}/block", cfg.handlerBlockUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", cfg.handlerUnblockUser)
+	ctx := context.Background()
+	blocker, blocked := createTestUser(t, cfg), createTestUser(t, cfg)
+	blockerJWT, blockedJWT := testJWT(t, cfg, blocker), testJWT(t, cfg, blocked)
+
+	for _, user := range []database.User{blocker, blocked} {
+		if _, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID}); err != nil {
+			t.Fatalf("Error creating chirp - %v", err)
+		}
+	}
+	var conversation Conversation
+	if status := serveTestRequest(t, mux, "POST", "/api/conversations", blockedJWT, map[string]string{"recipient_id": blocker.ID.String()}, &conversation); status != http.StatusCreated {
+		t.Fatalf("start conversation status = %d, want 201", status)
+	}
+	if status := serveTestRequest(t, mux, "POST", "/api/users/"+blocked.ID.String()+"/block", blockerJWT, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("block status = %d, want 204", status)
+	}
+
+	// seesChirpsBy reports whether the viewer's chirp feed has any chirps
+	// by author.
+	seesChirpsBy := func(viewerJWT string, author database.User) bool {
+		t.Helper()
+		var chirps []Chirp
+		if status := serveTestRequest(t, mux, "GET", "/api/chirps?author_id="+author.ID.String(), viewerJWT, nil, &chirps); status != http.StatusOK {
+			t.Fatalf("get chirps status = %d, want 200", status)
+		}
+		return len(chirps) > 0
+	}
+	tests := []struct {
+		name       string
+		jwt        string
+		recipient  database.User
+		wantStatus int
+	}{
+		{name: "blocked user", jwt: blockedJWT, recipient: blocker, wantStatus: http.StatusForbidden},
+		{name: "blocker", jwt: blockerJWT, recipient: blocked, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := serveTestRequest(t, mux, "POST", "/api/conversations", tt.jwt, map[string]string{"recipient_id": tt.recipient.ID.String()}, nil); status != tt.wantStatus {
+				t.Errorf("start conversation status = %d, want %d", status, tt.wantStatus)
+			}
+			if status := serveTestRequest(t, mux, "POST", "/api/conversations/"+conversation.ID.String()+"/messages", tt.jwt, map[string]string{"body": "hello"}, nil); status != tt.wantStatus {
+				t.Errorf("send message status = %d, want %d", status, tt.wantStatus)
+			}
+			if seesChirpsBy(tt.jwt, tt.recipient) {
+				t.Errorf("chirps by the other user are visible")
+			}
+		})
+	}
+
+	if status := serveTestRequest(t, mux, "DELETE", "/api/users/"+blocked.ID.String()+"/block", blockerJWT, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("unblock status = %d, want 204", status)
+	}
+	if !seesChirpsBy(blockerJWT, blocked) || !seesChirpsBy(blockedJWT, blocker) {
+		t.Errorf("chirps are still hidden after unblocking")
+	}
+	if status := serveTestRequest(t, mux, "POST", "/api/conversations/"+conversation.ID.String()+"/messages", blockedJWT, map[string]string{"body": "hello"}, nil); status != http.StatusCreated {
+		t.Errorf("send message after unblocking status = %d, want 201", status)
+	}
+}
+
+func TestResolveReportIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/reports", cfg.handlerCreateReport)
+	mux.Handle("POST /admin/reports/{reportID}/resolve", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminResolveReport))
+	ctx := context.Background()
+	reporter, reported := createTestUser(t, cfg), createTestUser(t, cfg)
+	moderator := createTestUser(t, cfg)
+	moderator, err := cfg.db.SetUserRole(ctx, database.SetUserRoleParams{Role: roleModerator, ID: moderator.ID})
+	if err != nil {
+		t.Fatalf("Error setting role - %v", err)
+	}
+	chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: "spam spam spam", UserID: reported.ID})
+	if err != nil {
+		t.Fatalf("Error creating chirp - %v", err)
+	}
+	var report Report
+	if status := serveTestRequest(t, mux, "POST", "/api/reports", testJWT(t, cfg, reporter), map[string]string{"chirp_id": chirp.ID.String(), "reason": "spam"}, &report); status != http.StatusCreated {
+		t.Fatalf("create report status = %d, want 201", status)
+	}
+
+	// Concurrent resolutions must not both apply their actions.
+	const attempts = 5
+	moderatorJWT := testJWT(t, cfg, moderator)
+	resolve := map[string]any{"status": reportStatusActioned, "actions": []string{moderationActionHideChirp, moderationActionSuspendUser}}
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- serveTestRequest(t, mux, "POST", "/admin/reports/"+report.ID.String()+"/resolve", moderatorJWT, resolve, nil)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != attempts-1 {
+		t.Errorf("resolve statuses = %v, want one 200 and %d 409", counts, attempts-1)
+	}
+	actions, err := cfg.db.GetModerationActionsByReport(ctx, uuid.NullUUID{UUID: report.ID, Valid: true})
+	if err != nil || len(actions) != 2 {
+		t.Errorf("moderation actions = %d, %v, want 2", len(actions), err)
+	}
+	notifications, err := cfg.db.GetNotificationsForUser(ctx, reporter.ID)
+	if err != nil || len(notifications) != 1 {
+		t.Errorf("reporter notifications = %d, %v, want 1", len(notifications), err)
+	}
+	stored, err := cfg.db.GetChirpByID(ctx, chirp.ID)
+	if err != nil || !stored.HiddenAt.Valid {
+		t.Errorf("reported chirp was not hidden")
+	}
+	if user, err := cfg.db.GetUserByID(ctx, reported.ID); err != nil || !user.SuspendedAt.Valid {
+		t.Errorf("reported user was not suspended")
+	}
+}
+
+func TestRoleAuthorizationIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/metrics", cfg.middlewareRequireRole(roleModerator, cfg.ReturnMetrics))
+	mux.Handle("PUT /admin/users/{userID}/role", cfg.middlewareRequireRole(roleAdmin, cfg.handlerAdminSetRole))
+	ctx := context.Background()
+	admin := createTestUser(t, cfg)
+	admin, err := cfg.db.SetUserRole(ctx, database.SetUserRoleParams{Role: roleAdmin, ID: admin.ID})
+	if err != nil {
+		t.Fatalf("Error setting role - %v", err)
+	}
+	adminJWT := testJWT(t, cfg, admin)
+	user := createTestUser(t, cfg)
+	// The token is issued while the user has no role, and kept throughout.
+	userJWT := testJWT(t, cfg, user)
+	setRole := func(bearer string, target database.User, role string) int {
+		t.Helper()
+		return serveTestRequest(t, mux, "PUT", "/admin/users/"+target.ID.String()+"/role", bearer, map[string]string{"role": role}, nil)
+	}
+	metrics := func() int {
+		t.Helper()
+		return serveTestRequest(t, mux, "GET", "/admin/metrics", userJWT, nil, nil)
+	}
+
+	if status := metrics(); status != http.StatusForbidden {
+		t.Errorf("metrics as a user status = %d, want 403", status)
+	}
+	if status := setRole(adminJWT, user, roleModerator); status != http.StatusOK {
+		t.Fatalf("promote to moderator status = %d, want 200", status)
+	}
+	if status := metrics(); status != http.StatusOK {
+		t.Errorf("metrics after promotion status = %d, want 200", status)
+	}
+	other := createTestUser(t, cfg)
+	if status := setRole(userJWT, other, roleModerator); status != http.StatusForbidden {
+		t.Errorf("set role as a moderator status = %d, want 403", status)
+	}
+	if status := setRole(adminJWT, user, roleUser); status != http.StatusOK {
+		t.Fatalf("demote status = %d, want 200", status)
+	}
+	if status := metrics(); status != http.StatusForbidden {
+		t.Errorf("metrics after demotion status = %d, want 403", status)
+	}
+}
+
+func TestPolkaWebhooksIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	server := httptest.NewServer(http.HandlerFunc(cfg.handlerPolkaWebhooks))
+	t.Cleanup(server.Close)
+	sim := polkasim.New(server.URL, "test-polka-key")
+	ctx := context.Background()
+
+	isChirpyRed := func(userID uuid.UUID) bool {
+		user, err := cfg.db.GetUserByID(ctx, userID)
+		if err != nil {
+			t.Fatalf("Error getting user - %v", err)
+		}
+		return user.IsChirpyRed
+	}
+	deliver := func(delivery polkasim.Delivery) int {
+		status, err := sim.Deliver(ctx, delivery)
+		if err != nil {
+			t.Fatalf("Deliver() error = %v", err)
+		}
+		return status
+	}
+
+	t.Run("upgrade then refund", func(t *testing.T) {
+		user := createTestUser(t, cfg)
+		upgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.upgraded", UserID: user.ID})
+		if status := deliver(upgrade); status != http.StatusNoContent {
+			t.Fatalf("upgrade status = %d, want %d", status, http.StatusNoContent)
+		}
+		if !isChirpyRed(user.ID) {
+			t.Errorf("user should be Chirpy Red after upgrade")
+		}
+		refund, _ := polkasim.NewDelivery(polkasim.Event{Name: "payment.refunded", UserID: user.ID})
+		deliver(refund)
+		if isChirpyRed(user.ID) {
+			t.Errorf("user should not be Chirpy Red after refund")
+		}
+	})
+
+	t.Run("duplicate deliveries are applied once", func(t *testing.T) {
+		user := createTestUser(t, cfg)
+		upgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.upgraded", UserID: user.ID})
+		statuses, err := sim.DeliverDuplicate(ctx, upgrade, 3)
+		if err != nil {
+			t.Fatalf("DeliverDuplicate() error = %v", err)
+		}
+		for i, status := range statuses {
+			if status != http.StatusNoContent {
+				t.Errorf("delivery %d status = %d, want %d", i, status, http.StatusNoContent)
+			}
+		}
+		saved, err := cfg.db.GetSubscriptionByUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error getting subscription - %v", err)
+		}
+		events, err := cfg.db.GetSubscriptionEvents(ctx, saved.ID)
+		if err != nil {
+			t.Fatalf("Error getting subscription events - %v", err)
+		}
+		if len(events) != 1 {
+			t.Errorf("got %d subscription events, want 1", len(events))
+		}
+	})
+
+	t.Run("out of order downgrade before upgrade", func(t *testing.T) {
+		user := createTestUser(t, cfg)
+		upgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.upgraded", UserID: user.ID})
+		downgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.downgraded", UserID: user.ID})
+		if _, err := sim.DeliverOutOfOrder(ctx, []polkasim.Delivery{upgrade, downgrade}); err != nil {
+			t.Fatalf("DeliverOutOfOrder() error = %v", err)
+		}
+		// The downgrade arrives before any subscription exists and is
+		// acknowledged without effect, so the later upgrade wins.
+		if !isChirpyRed(user.ID) {
+			t.Errorf("user should be Chirpy Red")
+		}
+	})
+
+	t.Run("legacy member keeps Chirpy Red after downgrade", func(t *testing.T) {
+		user := createTestUser(t, cfg)
+		if err := cfg.db.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{IsChirpyRed: true, ID: user.ID}); err != nil {
+			t.Fatalf("Error setting Chirpy Red - %v", err)
+		}
+		periodEnd := time.Now().Add(7 * 24 * time.Hour).UTC().Truncate(time.Second)
+		downgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.downgraded", UserID: user.ID, PeriodEnd: periodEnd})
+		deliver(downgrade)
+		if !isChirpyRed(user.ID) {
+			t.Errorf("user should stay Chirpy Red until the period ends")
+		}
+		saved, err := cfg.db.GetSubscriptionByUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error getting subscription - %v", err)
+		}
+		if saved.Status != "canceled" || !saved.CurrentPeriodEnd.Equal(periodEnd) {
+			t.Errorf("subscription = %s until %s, want canceled until %s", saved.Status, saved.CurrentPeriodEnd, periodEnd)
+		}
+	})
+
+	t.Run("wrong key is rejected", func(t *testing.T) {
+		user := createTestUser(t, cfg)
+		badSim := polkasim.New(server.URL, "wrong-key")
+		upgrade, _ := polkasim.NewDelivery(polkasim.Event{Name: "user.upgraded", UserID: user.ID})
+		status, err := badSim.Deliver(ctx, upgrade)
+		if err != nil {
+			t.Fatalf("Deliver() error = %v", err)
+		}
+		if status != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+		}
+		if isChirpyRed(user.ID) {
+			t.Errorf("user should not be Chirpy Red")
+		}
+	})
+}
+
+func TestOutboundWebhooksIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	var received, failures atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if err := auth.VerifyWebhookSignature(req.Header.Get(webhooks.SignatureHeader), body, req.Header.Get(webhooks.DeliveryIDHeader), []string{"test-webhook-secret"}, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	user := createTestUser(t, cfg)
+	webhook, err := cfg.db.CreateOutboundWebhook(ctx, database.CreateOutboundWebhookParams{
+		UserID: user.ID,
+		Url:    receiver.URL,
+		Secret: "test-webhook-secret",
+		Events: []string{webhooks.EventChirpCreated},
+		Scope:  webhookScopeUser,
+	})
+	if err != nil {
+		t.Fatalf("Error creating webhook - %v", err)
+	}
+
+	failures.Store(1)
+	cfg.enqueueWebhookEvent(ctx, user.ID, webhooks.EventChirpCreated, Chirp{Body: "hello", UserID: user.ID})
+	cfg.enqueueWebhookEvent(ctx, user.ID, webhooks.EventChirpDeleted, Chirp{Body: "hello", UserID: user.ID})
+	if err := cfg.processWebhookDeliveries(ctx, time.Now()); err != nil {
+		t.Fatalf("processWebhookDeliveries() error = %v", err)
+	}
+	deliveries, err := cfg.db.GetOutboundWebhookDeliveries(ctx, database.GetOutboundWebhookDeliveriesParams{WebhookID: webhook.ID, Limit: 10})
+	if err != nil {
+		t.Fatalf("Error getting deliveries - %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1 for the subscribed event only", len(deliveries))
+	}
+	if deliveries[0].Status != webhooks.StatusPending || deliveries[0].Attempts != 1 {
+		t.Errorf("after failed attempt status = %s attempts = %d, want pending after 1", deliveries[0].Status, deliveries[0].Attempts)
+	}
+
+	// Move the retry forward instead of waiting out the backoff.
+	if _, err := cfg.db.RetryOutboundWebhookDelivery(ctx, database.RetryOutboundWebhookDeliveryParams{ID: deliveries[0].ID, WebhookID: webhook.ID}); err != nil {
+		t.Fatalf("Error requeueing delivery - %v", err)
+	}
+	if err := cfg.processWebhookDeliveries(ctx, time.Now()); err != nil {
+		t.Fatalf("processWebhookDeliveries() error = %v", err)
+	}
+	if received.Load() != 1 {
+		t.Errorf("receiver got %d deliveries, want 1", received.Load())
+	}
+}
+
+func TestScheduledChirpWebhooksIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	user := createTestUser(t, cfg)
+	webhook, err := cfg.db.CreateOutboundWebhook(ctx, database.CreateOutboundWebhookParams{
+		UserID: user.ID,
+		Url:    "http://127.0.0.1:9999/hook",
+		Secret: "test-webhook-secret",
+		Events: []string{webhooks.EventChirpCreated},
+		Scope:  webhookScopeUser,
+	})
+	if err != nil {
+		t.Fatalf("Error creating webhook - %v", err)
+	}
+	createScheduled := func(publishAt time.Time) database.Chirp {
+		t.Helper()
+		chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{
+			Body:      "scheduled",
+			UserID:    user.ID,
+			PublishAt: sql.NullTime{Time: publishAt.UTC(), Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("Error creating chirp - %v", err)
+		}
+		return chirp
+	}
+	due := createScheduled(time.Now().Add(-time.Second))
+	createScheduled(time.Now().Add(time.Hour))
+
+	for range 2 {
+		if err := cfg.announceScheduledChirps(ctx); err != nil {
+			t.Fatalf("announceScheduledChirps() error = %v", err)
+		}
+	}
+	deliveries, err := cfg.db.GetOutboundWebhookDeliveries(ctx, database.GetOutboundWebhookDeliveriesParams{WebhookID: webhook.ID, Limit: 10})
+	if err != nil {
+		t.Fatalf("Error getting deliveries - %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1 for the published chirp", len(deliveries))
+	}
+	var payload struct {
+		Event string `json:"event"`
+		Data  Chirp  `json:"data"`
+	}
+	json.Unmarshal(deliveries[0].Payload, &payload)
+	if payload.Event != webhooks.EventChirpCreated || payload.Data.ID != due.ID {
+		t.Errorf("delivery = %s for %s, want %s for %s", payload.Event, payload.Data.ID, webhooks.EventChirpCreated, due.ID)
+	}
+}
+
+func TestOAuthAuthorizationCodeIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/oauth/clients", cfg.handlerCreateOAuthClient)
+	mux.HandleFunc("POST /api/oauth/authorize", cfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/token", cfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", cfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", cfg.handlerOAuthRevoke)
+	mux.Handle("GET /api/chirps/scheduled", cfg.middlewareRequireScope(scopes.ChirpsRead, cfg.handlerScheduledChirps))
+	mux.Handle("POST /api/chirps", cfg.middlewareRequireScope(scopes.ChirpsWrite, cfg.handlerAddChirp))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	user := createTestUser(t, cfg)
+	jwt, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.secret, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating JWT - %v", err)
+	}
+
+	call := func(method, path, bearer string, body any, form url.Values, out any) int {
+		t.Helper()
+		var reqBody io.Reader
+		contentType := "application/json"
+		if form != nil {
+			reqBody = strings.NewReader(form.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		} else if body != nil {
+			data, _ := json.Marshal(body)
+			reqBody = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, reqBody)
+		req.Header.Set("Content-Type", contentType)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	redirectURI := "http://127.0.0.1:9999/callback"
+	var client OAuthClient
+	if status := call("POST", "/api/oauth/clients", jwt, map[string]any{
+		"name":          "Local client",
+		"redirect_uris": []string{redirectURI},
+		"scopes":        []string{scopes.ChirpsRead, scopes.ChirpsWrite},
+	}, nil, &client); status != http.StatusCreated {
+		t.Fatalf("create client status = %d", status)
+	}
+
+	verifier := strings.Repeat("v", 64)
+	var authorization struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	call("POST", "/api/oauth/authorize", jwt, map[string]any{
+		"response_type":         "code",
+		"client_id":             client.ID,
+		"redirect_uri":          redirectURI,
+		"scope":                 scopes.ChirpsRead,
+		"state":                 "xyz",
+		"code_challenge":        oauth.S256Challenge(verifier),
+		"code_challenge_method": oauth.CodeChallengeMethodS256,
+		"approve":               true,
+	}, nil, &authorization)
+	redirect, err := url.Parse(authorization.RedirectTo)
+	if err != nil || redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+		t.Fatalf("authorize redirect = %q, want code and state", authorization.RedirectTo)
+	}
+	codeForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.ID},
+		"code":          {redirect.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {strings.Repeat("w", 64)},
+	}
+	if status := call("POST", "/oauth/token", "", nil, codeForm, nil); status != http.StatusBadRequest {
+		t.Errorf("token with wrong code_verifier status = %d, want 400", status)
+	}
+	codeForm.Set("code_verifier", verifier)
+	var tokens OAuthTokenResponse
+	if status := call("POST", "/oauth/token", "", nil, codeForm, &tokens); status != http.StatusOK {
+		t.Fatalf("token status = %d", status)
+	}
+	if tokens.Scope != scopes.ChirpsRead {
+		t.Errorf("token scope = %q, want %q", tokens.Scope, scopes.ChirpsRead)
+	}
+
+	if status := call("GET", "/api/chirps/scheduled", tokens.AccessToken, nil, nil, nil); status != http.StatusOK {
+		t.Errorf("read with chirps:read token status = %d, want 200", status)
+	}
+	if status := call("POST", "/api/chirps", tokens.AccessToken, map[string]string{"body": "hi"}, nil, nil); status != http.StatusForbidden {
+		t.Errorf("write with chirps:read token status = %d, want 403", status)
+	}
+
+	var introspection OAuthIntrospection
+	call("POST", "/oauth/introspect", "", nil, url.Values{"client_id": {client.ID}, "token": {tokens.AccessToken}}, &introspection)
+	if !introspection.Active || introspection.Subject != user.ID.String() {
+		t.Errorf("introspection = %+v, want active for the user", introspection)
+	}
+
+	// Concurrent refreshes with the same token rotate it only once.
+	var refreshed OAuthTokenResponse
+	refreshForm := url.Values{"grant_type": {"refresh_token"}, "client_id": {client.ID}, "refresh_token": {tokens.RefreshToken}}
+	statuses := make([]int, 5)
+	responses := make([]OAuthTokenResponse, len(statuses))
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.PostForm(server.URL+"/oauth/token", refreshForm)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			statuses[i] = resp.StatusCode
+			json.NewDecoder(resp.Body).Decode(&responses[i])
+		}()
+	}
+	wg.Wait()
+	succeeded := 0
+	for i, status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+			refreshed = responses[i]
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("concurrent refresh statuses = %v, want exactly one 200", statuses)
+	}
+	// Reusing a rotated refresh token revokes the whole grant.
+	if status := call("POST", "/oauth/token", "", nil, refreshForm, nil); status != http.StatusBadRequest {
+		t.Errorf("refresh token reuse status = %d, want 400", status)
+	}
+	if status := call("GET", "/api/chirps/scheduled", refreshed.AccessToken, nil, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("access token after reuse status = %d, want 401", status)
+	}
+
+	call("POST", "/oauth/revoke", "", nil, url.Values{"client_id": {client.ID}, "token": {refreshed.RefreshToken}}, nil)
+	introspection = OAuthIntrospection{}
+	call("POST", "/oauth/introspect", "", nil, url.Values{"client_id": {client.ID}, "token": {refreshed.RefreshToken}}, &introspection)
+	if introspection.Active {
+		t.Errorf("revoked refresh token is still active")
+	}
+}
+
+func TestOIDCLoginIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	provider, err := idpsim.New("chirpy", "client-secret")
+	if err != nil {
+		t.Fatalf("idpsim.New() error = %v", err)
+	}
+	t.Cleanup(provider.Close)
+	cfg.oidc = oidc.New(oidc.Config{
+		Issuer:       provider.Issuer,
+		ClientID:     "chirpy",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://127.0.0.1:9999/callback",
+		Scopes:       []string{"email"},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login/oidc", cfg.handlerOIDCLogin)
+	mux.HandleFunc("POST /api/login/oidc/callback", cfg.handlerOIDCCallback)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	newBrowser := func() *http.Client {
+		t.Helper()
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatalf("cookiejar.New() error = %v", err)
+		}
+		return &http.Client{Jar: jar}
+	}
+	browser := newBrowser()
+	// authorize starts a login in browser and follows the provider back to
+	// the callback, returning the code and state the web app would post.
+	authorize := func(browser *http.Client) map[string]string {
+		t.Helper()
+		resp, err := browser.Post(server.URL+"/api/login/oidc", "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST /api/login/oidc error = %v", err)
+		}
+		var start struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		json.NewDecoder(resp.Body).Decode(&start)
+		resp.Body.Close()
+		resp, err = noRedirects.Get(start.AuthorizationURL)
+		if err != nil {
+			t.Fatalf("GET authorization URL error = %v", err)
+		}
+		resp.Body.Close()
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("provider redirect = %q", resp.Header.Get("Location"))
+		}
+		return map[string]string{"code": callback.Query().Get("code"), "state": callback.Query().Get("state")}
+	}
+	finish := func(browser *http.Client, body map[string]string, out any) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		resp, err := browser.Post(server.URL+"/api/login/oidc/callback", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("POST /api/login/oidc/callback error = %v", err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	email := uuid.NewString() + "@example.com"
+	provider.Identity = idpsim.Identity{Subject: uuid.NewString(), Email: email, EmailVerified: true}
+	callback := authorize(browser)
+	// A state only completes in the browser that started the login.
+	other := newBrowser()
+	authorize(other)
+	for name, browser := range map[string]*http.Client{"no cookie": http.DefaultClient, "another browser": other} {
+		if status := finish(browser, callback, nil); status != http.StatusBadRequest {
+			t.Errorf("callback from %s status = %d, want 400", name, status)
+		}
+	}
+	var first User
+	if status := finish(browser, callback, &first); status != http.StatusOK {
+		t.Fatalf("first login status = %d", status)
+	}
+	t.Cleanup(func() { cfg.db.DeleteUser(context.Background(), first.ID) })
+	if first.Email != email || !first.EmailVerified || first.Token == "" || first.RefreshToken == "" {
+		t.Errorf("first login user = %+v, want a verified account with tokens", first)
+	}
+	if status := finish(browser, callback, nil); status != http.StatusBadRequest {
+		t.Errorf("replayed state status = %d, want 400", status)
+	}
+
+	var second User
+	if status := finish(browser, authorize(browser), &second); status != http.StatusOK {
+		t.Fatalf("second login status = %d", status)
+	}
+	if second.ID != first.ID {
+		t.Errorf("second login user = %s, want the linked account %s", second.ID, first.ID)
+	}
+
+	// An existing password account with an unverified email is not taken
+	// over by an identity claiming the same address.
+	existing := createTestUser(t, cfg)
+	provider.Identity = idpsim.Identity{Subject: uuid.NewString(), Email: existing.Email, EmailVerified: true}
+	if status := finish(browser, authorize(browser), nil); status != http.StatusConflict {
+		t.Errorf("login as unverified existing account status = %d, want 409", status)
+	}
+}
+
+func TestIdempotencyKeysIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.idempotencyKeyTTL = time.Hour
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/users", cfg.middlewareIdempotency(cfg.handlerCreateUser))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	key := uuid.NewString()
+	createUser := func(email string) (*http.Response, User) {
+		t.Helper()
+		data, _ := json.Marshal(map[string]string{"email": email, "password": "correct horse battery"})
+		req, _ := http.NewRequest("POST", server.URL+"/api/users", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/users error = %v", err)
+		}
+		defer resp.Body.Close()
+		var user User
+		json.NewDecoder(resp.Body).Decode(&user)
+		return resp, user
+	}
+
+	email := uuid.NewString() + "@example.com"
+	resp, first := createUser(email)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first request status = %d, want 201", resp.StatusCode)
+	}
+	t.Cleanup(func() { cfg.db.DeleteUser(context.Background(), first.ID) })
+	resp, retried := createUser(email)
+	if resp.StatusCode != http.StatusCreated || retried.ID != first.ID {
+		t.Errorf("retry = %d %s, want the first response replayed", resp.StatusCode, retried.ID)
+	}
+	if resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry is not marked as replayed")
+	}
+	if resp, _ := createUser(uuid.NewString() + "@example.com"); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body status = %d, want 422", resp.StatusCode)
+	}
+
+	var panics, forbidden atomic.Int32
+	mux.Handle("POST /things/{id}", cfg.middlewareIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "panics" && panics.Add(1) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		if r.PathValue("id") == "forbidden" && forbidden.Add(1) == 1 {
+			writeErrorResponse(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]string{"id": r.PathValue("id")})
+	}))
+	postThing := func(id, key string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL+"/things/"+id, strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		var thing struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&thing)
+		return resp.StatusCode, thing.ID
+	}
+	body := sha256.Sum256([]byte("{}"))
+	claim := func(id, key string, lockedUntil time.Time) {
+		t.Helper()
+		if _, err := cfg.db.ClaimIdempotencyKey(context.Background(), database.ClaimIdempotencyKeyParams{
+			Owner:          "anonymous",
+			IdempotencyKey: key,
+			Route:          "POST /things/" + id,
+			RequestHash:    hex.EncodeToString(body[:]),
+			ExpiresAt:      time.Now().UTC().Add(time.Hour),
+			LockedUntil:    lockedUntil,
+		}); err != nil {
+			t.Fatalf("Error claiming idempotency key - %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(key string)
+		id         string
+		wantStatus int
+	}{
+		{
+			name:       "same key on another path",
+			setup:      func(key string) { postThing("a", key) },
+			id:         "b",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "retry after a panic",
+			setup:      func(key string) { postThing("panics", key) },
+			id:         "panics",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "request still in progress",
+			setup:      func(key string) { claim("c", key, time.Now().UTC().Add(time.Minute)) },
+			id:         "c",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "abandoned claim is taken over",
+			setup:      func(key string) { claim("d", key, time.Now().UTC().Add(-time.Minute)) },
+			id:         "d",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "retry after a forbidden response",
+			setup:      func(key string) { postThing("forbidden", key) },
+			id:         "forbidden",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "late response to a claim that was taken over is dropped",
+			setup: func(key string) {
+				abandoned := time.Now().UTC().Add(-time.Minute).Truncate(time.Microsecond)
+				claim("e", key, abandoned)
+				claim("e", key, time.Now().UTC().Add(time.Minute))
+				if err := cfg.db.SaveIdempotentResponse(context.Background(), database.SaveIdempotentResponseParams{
+					StatusCode:     sql.NullInt32{Int32: http.StatusOK, Valid: true},
+					ContentType:    sql.NullString{String: "application/json", Valid: true},
+					ResponseBody:   []byte(`{"id":"late"}`),
+					Owner:          "anonymous",
+					IdempotencyKey: key,
+					Route:          "POST /things/e",
+					RequestHash:    hex.EncodeToString(body[:]),
+					LockedUntil:    abandoned,
+				}); err != nil {
+					t.Fatalf("Error saving idempotent response - %v", err)
+				}
+			},
+			id:         "e",
+			wantStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := uuid.NewString()
+			tt.setup(key)
+			status, id := postThing(tt.id, key)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status == http.StatusOK && id != tt.id {
+				t.Errorf("response id = %q, want %q", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestClientIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.idempotencyKeyTTL = time.Hour
+	mux := http.NewServeMux()
+	for _, route := range cfg.routes() {
+		mux.Handle(route.pattern, route.handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	c := client.New(server.URL, server.Client())
+
+	email := uuid.NewString() + "@example.com"
+	user, err := c.CreateUser(ctx, email, "correct horse battery")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	t.Cleanup(func() { cfg.db.DeleteUser(context.Background(), user.ID) })
+	if _, err := c.CreateUser(ctx, "not an email", "correct horse battery"); !client.IsCode(err, client.CodeValidationFailed) {
+		t.Errorf("CreateUser() with an invalid email error = %v, want validation_failed", err)
+	}
+	if _, err := c.Login(ctx, email, "correct horse battery"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	chirp, err := c.CreateChirp(ctx, client.CreateChirpRequest{Body: "Hello from the client"})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	chirps, err := c.ListChirps(ctx, client.ListChirpsOptions{AuthorID: user.ID})
+	if err != nil || len(chirps) != 1 || chirps[0].ID != chirp.ID {
+		t.Errorf("ListChirps() = %v, %v, want the new chirp", chirps, err)
+	}
+
+	// An expired access token is replaced using the refresh token.
+	tokens := c.Tokens()
+	c.SetTokens(client.Tokens{AccessToken: "expired", RefreshToken: tokens.RefreshToken})
+	updated, err := c.UpdateChirp(ctx, chirp.ID, "Edited from the client")
+	if err != nil || updated.Body != "Edited from the client" {
+		t.Fatalf("UpdateChirp() = %v, %v", updated, err)
+	}
+	if c.Tokens().AccessToken == "expired" {
+		t.Errorf("access token was not refreshed")
+	}
+	if err := c.DeleteChirp(ctx, chirp.ID); err != nil {
+		t.Errorf("DeleteChirp() error = %v", err)
+	}
+	if _, err := c.GetChirp(ctx, chirp.ID); !client.IsCode(err, client.CodeNotFound) {
+		t.Errorf("GetChirp() after delete error = %v, want not_found", err)
+	}
+
+	// Changing the password signs out every other session.
+	other := client.New(server.URL, server.Client())
+	if _, err := other.Login(ctx, email, "correct horse battery"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, err := c.UpdateUser(ctx, email, "battery staple horse"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if _, err := other.Refresh(ctx); !client.IsCode(err, client.CodeUnauthorized) {
+		t.Errorf("Refresh() in another session after a password change error = %v, want unauthorized", err)
+	}
+
+	webhook, err := c.CreateWebhook(ctx, client.CreateWebhookRequest{URL: "https://example.com/hook", Events: []string{webhooks.EventChirpCreated}})
+	if err != nil || webhook.Secret == "" {
+		t.Fatalf("CreateWebhook() = %v, %v", webhook, err)
+	}
+	active := false
+	if webhook, err = c.UpdateWebhook(ctx, webhook.ID, client.UpdateWebhookRequest{Active: &active}); err != nil || webhook.Active {
+		t.Errorf("UpdateWebhook() = %v, %v", webhook, err)
+	}
+	if list, err := c.ListWebhooks(ctx); err != nil || len(list) != 1 {
+		t.Errorf("ListWebhooks() = %v, %v", list, err)
+	}
+	if err := c.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Errorf("DeleteWebhook() error = %v", err)
+	}
+
+	if err := c.Revoke(ctx); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	c.SetTokens(client.Tokens{RefreshToken: tokens.RefreshToken})
+	if _, err := c.Refresh(ctx); !client.IsCode(err, client.CodeUnauthorized) {
+		t.Errorf("Refresh() with a revoked token error = %v, want unauthorized", err)
+	}
+}
+
+func TestTwoFactorIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", cfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/users/me/2fa", cfg.handlerEnrollTOTP)
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", cfg.handlerConfirmTOTP)
+	mux.HandleFunc("DELETE /api/users/me/2fa", cfg.handlerDisableTOTP)
+	mux.HandleFunc("POST /api/users/me/2fa/recovery-codes", cfg.handlerRegenerateRecoveryCodes)
+	ctx := context.Background()
+
+	const password = "correct horse battery"
+	user := createTestUser(t, cfg)
+	setTestPassword(t, cfg, user, password)
+	jwt := testJWT(t, cfg, user)
+	otherSession, err := cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     uuid.NewString(),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Error creating refresh token - %v", err)
+	}
+
+	call := func(method, path, bearer string, body any, out any) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if out != nil {
+			json.NewDecoder(rec.Body).Decode(out)
+		}
+		return rec.Code
+	}
+
+	var enrollment TOTPEnrollment
+	if status := call("POST", "/api/users/me/2fa", jwt, nil, &enrollment); status != http.StatusOK {
+		t.Fatalf("enroll status = %d", status)
+	}
+	stored, err := cfg.db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Error getting user - %v", err)
+	}
+	if !auth.IsSealed(stored.TotpSecret.String) || strings.Contains(stored.TotpSecret.String, enrollment.Secret) {
+		t.Errorf("stored TOTP secret %q is not encrypted", stored.TotpSecret.String)
+	}
+	code := func(offset int64) string {
+		t.Helper()
+		code, err := totp.Code(enrollment.Secret, totp.Step(time.Now())+offset)
+		if err != nil {
+			t.Fatalf("Error generating code - %v", err)
+		}
+		return code
+	}
+
+	var confirmation TOTPConfirmation
+	confirmTests := []struct {
+		name       string
+		code       string
+		out        any
+		wantStatus int
+	}{
+		{name: "wrong code", code: "000000", wantStatus: http.StatusUnauthorized},
+		// The previous step is used so that the current one is still
+		// unused for the login below.
+		{name: "valid code", code: code(-1), out: &confirmation, wantStatus: http.StatusOK},
+		{name: "already enabled", code: code(0), wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range confirmTests {
+		t.Run("confirm "+tt.name, func(t *testing.T) {
+			if status := call("POST", "/api/users/me/2fa/confirm", jwt, map[string]string{"code": tt.code}, tt.out); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+	if len(confirmation.RecoveryCodes) != recoveryCodeCount || confirmation.Token == "" || confirmation.RefreshToken == "" {
+		t.Fatalf("confirmation = %+v, want recovery codes and new tokens", confirmation)
+	}
+	if revoked, err := cfg.db.GetUserFromRefreshToken(ctx, otherSession.Token); err != nil || !revoked.RevokedAt.Valid {
+		t.Errorf("other session was not revoked after enabling two-factor login")
+	}
+	if status := call("POST", "/api/users/me/2fa", confirmation.Token, nil, nil); status != http.StatusConflict {
+		t.Errorf("enroll with the new token status = %d, want 409", status)
+	}
+
+	var challenge MFAChallenge
+	if status := call("POST", "/api/login", "", map[string]string{"email": user.Email, "password": password}, &challenge); status != http.StatusOK || !challenge.MFARequired {
+		t.Fatalf("login = %d %+v, want an MFA challenge", status, challenge)
+	}
+	current := code(0)
+	loginTests := []struct {
+		name       string
+		body       map[string]string
+		wantStatus int
+	}{
+		{name: "no second factor", body: map[string]string{}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong code", body: map[string]string{"code": "000000"}, wantStatus: http.StatusUnauthorized},
+		{name: "valid code", body: map[string]string{"code": current}, wantStatus: http.StatusOK},
+		{name: "replayed code", body: map[string]string{"code": current}, wantStatus: http.StatusUnauthorized},
+		{name: "recovery code", body: map[string]string{"recovery_code": strings.ToLower(confirmation.RecoveryCodes[0])}, wantStatus: http.StatusOK},
+		{name: "used recovery code", body: map[string]string{"recovery_code": confirmation.RecoveryCodes[0]}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range loginTests {
+		t.Run("login "+tt.name, func(t *testing.T) {
+			tt.body["mfa_token"] = challenge.MFAToken
+			var result User
+			status := call("POST", "/api/login/mfa", "", tt.body, &result)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status == http.StatusOK && (result.Token == "" || result.RefreshToken == "") {
+				t.Errorf("login = %+v, want tokens", result)
+			}
+		})
+	}
+	cfg.clearLoginFailures(ctx, accountLoginKey(user.Email))
+
+	var regenerated RecoveryCodes
+	regenerate := map[string]string{"password": password, "recovery_code": confirmation.RecoveryCodes[1]}
+	if status := call("POST", "/api/users/me/2fa/recovery-codes", confirmation.Token, regenerate, &regenerated); status != http.StatusOK || len(regenerated.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("regenerate = %d %+v", status, regenerated)
+	}
+	regenerate = map[string]string{"password": password, "recovery_code": confirmation.RecoveryCodes[2]}
+	if status := call("POST", "/api/users/me/2fa/recovery-codes", confirmation.Token, regenerate, nil); status != http.StatusUnauthorized {
+		t.Errorf("regenerate with a replaced recovery code status = %d, want 401", status)
+	}
+	failure, err := cfg.db.GetLoginFailure(ctx, accountLoginKey(user.Email))
+	if err != nil || failure.Failures != 1 {
+		t.Errorf("login failures after a wrong recovery code = %+v, %v, want 1", failure, err)
+	}
+
+	var disabled User
+	disable := map[string]string{"password": password, "recovery_code": regenerated.RecoveryCodes[0]}
+	if status := call("DELETE", "/api/users/me/2fa", confirmation.Token, disable, &disabled); status != http.StatusOK || disabled.Token == "" || disabled.RefreshToken == "" {
+		t.Fatalf("disable = %d %+v, want new tokens", status, disabled)
+	}
+	if _, err := cfg.db.GetLoginFailure(ctx, accountLoginKey(user.Email)); err != sql.ErrNoRows {
+		t.Errorf("login failures were not cleared after reauthenticating")
+	}
+	if status := call("POST", "/api/users/me/2fa", confirmation.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("enroll with the token from before disabling status = %d, want 401", status)
+	}
+	if status := call("POST", "/api/users/me/2fa", disabled.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("enroll with the new token status = %d, want 200", status)
+	}
+}
+
+func TestAdminSuspendUserIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin/users/{userID}/suspend", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminSuspendUser))
+	mux.Handle("POST /admin/users/{userID}/unsuspend", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminUnsuspendUser))
+	ctx := context.Background()
+
+	withRole := func(role string) database.User {
+		t.Helper()
+		user := createTestUser(t, cfg)
+		user, err := cfg.db.SetUserRole(ctx, database.SetUserRoleParams{Role: role, ID: user.ID})
+		if err != nil {
+			t.Fatalf("Error setting role - %v", err)
+		}
+		return user
+	}
+	moderator := withRole(roleModerator)
+	jwt := testJWT(t, cfg, moderator)
+
+	tests := []struct {
+		name       string
+		action     string
+		target     database.User
+		wantStatus int
+	}{
+		{name: "suspend user", action: "suspend", target: withRole(roleUser), wantStatus: http.StatusNoContent},
+		{name: "suspend moderator", action: "suspend", target: withRole(roleModerator), wantStatus: http.StatusForbidden},
+		{name: "suspend admin", action: "suspend", target: withRole(roleAdmin), wantStatus: http.StatusForbidden},
+		{name: "unsuspend admin", action: "unsuspend", target: withRole(roleAdmin), wantStatus: http.StatusForbidden},
+		{name: "suspend yourself", action: "suspend", target: moderator, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/users/"+tt.target.ID.String()+"/"+tt.action, nil)
+			req.Header.Set("Authorization", "Bearer "+jwt)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			target, err := cfg.db.GetUserByID(ctx, tt.target.ID)
+			if err != nil {
+				t.Fatalf("Error getting user - %v", err)
+			}
+			if wantSuspended := tt.wantStatus == http.StatusNoContent && tt.action == "suspend"; target.SuspendedAt.Valid != wantSuspended {
+				t.Errorf("suspended = %t, want %t", target.SuspendedAt.Valid, wantSuspended)
+			}
+		})
+	}
+}
+
+func TestAccountStatusIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.deletionGracePeriod = time.Hour
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin/users/{userID}/suspend", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminSuspendUser))
+	mux.Handle("GET /api/chirps/scheduled", cfg.middlewareRequireScope(scopes.ChirpsRead, cfg.handlerScheduledChirps))
+	mux.HandleFunc("DELETE /api/users", cfg.handlerDeleteUser)
+	mux.HandleFunc("POST /api/users/restore", cfg.handlerRestoreUser)
+	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
+	ctx := context.Background()
+	const password = "correct horse battery"
+
+	call := func(method, path, bearer string, body any) int {
+		t.Helper()
+		return serveTestRequest(t, mux, method, path, bearer, body, nil)
+	}
+	type credentials struct {
+		jwt, refreshToken, personalAccessToken string
+	}
+	// signIn returns every kind of credential a user can hold.
+	signIn := func(user database.User) credentials {
+		t.Helper()
+		user, err := cfg.db.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Error getting user - %v", err)
+		}
+		session, err := cfg.issueTokens(httptest.NewRequest("POST", "/api/login", nil), user)
+		if err != nil {
+			t.Fatalf("Error issuing tokens - %v", err)
+		}
+		pat, err := auth.MakePersonalAccessToken()
+		if err != nil {
+			t.Fatalf("Error creating personal access token - %v", err)
+		}
+		if _, err := cfg.db.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    user.ID,
+			Name:      "test",
+			TokenHash: auth.HashToken(pat),
+			Scopes:    []string{scopes.ChirpsRead},
+		}); err != nil {
+			t.Fatalf("Error creating personal access token - %v", err)
+		}
+		return credentials{jwt: session.Token, refreshToken: session.RefreshToken, personalAccessToken: pat}
+	}
+
+	admin := createTestUser(t, cfg)
+	admin, err := cfg.db.SetUserRole(ctx, database.SetUserRoleParams{Role: roleAdmin, ID: admin.ID})
+	if err != nil {
+		t.Fatalf("Error setting role - %v", err)
+	}
+	adminCredentials := signIn(admin)
+
+	tests := []struct {
+		name    string
+		disable func(user database.User, creds credentials) int
+	}{
+		{
+			name: "suspended",
+			disable: func(user database.User, _ credentials) int {
+				return call("POST", "/admin/users/"+user.ID.String()+"/suspend", adminCredentials.jwt, nil)
+			},
+		},
+		{
+			name: "deleted",
+			disable: func(_ database.User, creds credentials) int {
+				return call("DELETE", "/api/users", creds.jwt, map[string]string{"password": password})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, cfg)
+			setTestPassword(t, cfg, user, password)
+			creds := signIn(user)
+			if status := call("GET", "/api/chirps/scheduled", creds.personalAccessToken, nil); status != http.StatusOK {
+				t.Fatalf("personal access token before status = %d, want 200", status)
+			}
+			if status := tt.disable(user, creds); status >= http.StatusBadRequest {
+				t.Fatalf("disabling the account status = %d", status)
+			}
+			for name, status := range map[string]int{
+				"access token":          call("GET", "/api/chirps/scheduled", creds.jwt, nil),
+				"personal access token": call("GET", "/api/chirps/scheduled", creds.personalAccessToken, nil),
+				"refresh token":         call("POST", "/api/refresh", creds.refreshToken, nil),
+			} {
+				if status != http.StatusUnauthorized {
+					t.Errorf("%s status = %d, want 401", name, status)
+				}
+			}
+		})
+	}
+
+	// A deleted account can be restored until it is purged.
+	user := createTestUser(t, cfg)
+	setTestPassword(t, cfg, user, password)
+	restore := map[string]string{"email": user.Email, "password": password}
+	if status := call("DELETE", "/api/users", signIn(user).jwt, map[string]string{"password": password}); status != http.StatusAccepted {
+		t.Fatalf("delete status = %d, want 202", status)
+	}
+	if status := call("POST", "/api/users/restore", "", restore); status != http.StatusOK {
+		t.Errorf("restore within the grace period status = %d, want 200", status)
+	}
+	if status := call("DELETE", "/api/users", signIn(user).jwt, map[string]string{"password": password}); status != http.StatusAccepted {
+		t.Fatalf("second delete status = %d, want 202", status)
+	}
+	if _, err := cfg.db.PurgeDeletedUsers(ctx, sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}); err != nil {
+		t.Fatalf("Error purging users - %v", err)
+	}
+	if status := call("POST", "/api/users/restore", "", restore); status != http.StatusUnauthorized {
+		t.Errorf("restore after purge status = %d, want 401", status)
+	}
+	cfg.clearLoginFailures(ctx, accountLoginKey(user.Email))
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	trusted, _ := ratelimit.ParseTrustedProxies("10.0.0.1")
+	cfg := &apiConfig{rateLimiter: ratelimit.NewMemoryStore(), trustedProxies: trusted}
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/login", cfg.middlewareRateLimit(signInRateLimit, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	login := func(forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/login", nil)
+		req.RemoteAddr = "10.0.0.1:4000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range signInRateLimit.perIP.Requests {
+		if rec := login("203.0.113.1"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d status = %d, want 204", i, rec.Code)
+		}
+	}
+	rec := login("203.0.113.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("limited response headers = %v", rec.Header())
+	}
+	if rec := login("203.0.113.2"); rec.Code != http.StatusNoContent {
+		t.Errorf("request from another client behind the proxy status = %d, want 204", rec.Code)
+	}
+}
+
+func TestUserRateLimitIntegration(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.rateLimiter = ratelimit.NewMemoryStore()
+	plan := entitlements.For(false).RequestsPerMinute
+	mux := http.NewServeMux()
+	mux.Handle("POST /floor", cfg.middlewareRateLimit(rateLimitPolicy{perIP: ratelimit.PerMinute(3), byUser: true}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.Handle("POST /plan", cfg.middlewareRateLimit(rateLimitPolicy{perIP: ratelimit.PerMinute(10 * plan), byUser: true}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	bearer := func() string {
+		t.Helper()
+		user := createTestUser(t, cfg)
+		jwt, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.secret, time.Hour)
+		if err != nil {
+			t.Fatalf("Error creating JWT - %v", err)
+		}
+		return jwt
+	}
+	call := func(path, jwt string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+jwt)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Each request comes from a new user, so only the limit per IP applies.
+	for i := range 3 {
+		if status := call("/floor", bearer()); status != http.StatusNoContent {
+			t.Fatalf("request %d status = %d, want 204", i, status)
+		}
+	}
+	if status := call("/floor", bearer()); status != http.StatusTooManyRequests {
+		t.Errorf("request from another user over the limit per IP status = %d, want 429", status)
+	}
+
+	first := bearer()
+	for i := range plan {
+		if status := call("/plan", first); status != http.StatusNoContent {
+			t.Fatalf("request %d status = %d, want 204", i, status)
+		}
+	}
+	if status := call("/plan", first); status != http.StatusTooManyRequests {
+		t.Errorf("request over the plan limit status = %d, want 429", status)
+	}
+	if status := call("/plan", bearer()); status != http.StatusNoContent {
+		t.Errorf("request from another user status = %d, want 204", status)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	cfg := &apiConfig{passwordPolicy: auth.NewPasswordPolicy(defaultPasswordMinLength, maxPasswordLength)}
+	// decodeInto is a handler that only decodes a request body into dst.
+	decodeInto := func(dst any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if decodeRequest(w, r, dst) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+	}
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantFields  []string
+	}{
+		{
+			name:       "malformed JSON on create user",
+			handler:    cfg.handlerCreateUser,
+			body:       `{"email":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeInvalidJSON,
+		},
+		{
+			name:       "malformed JSON on login",
+			handler:    cfg.handlerLogin,
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeInvalidJSON,
+		},
+		{
+			name:       "invalid fields on create user",
+			handler:    cfg.handlerCreateUser,
+			body:       `{"email": "not-an-email", "password": "short"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"email", "password"},
+		},
+		{
+			name:       "missing required fields",
+			handler:    cfg.handlerLogin,
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"password", "email"},
+		},
+		{
+			name:       "unknown field",
+			handler:    cfg.handlerLogin,
+			body:       `{"email": "a@example.com", "password": "x", "admin": true}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeInvalidJSON,
+			wantFields: []string{"admin"},
+		},
+		{
+			name:       "wrong type",
+			handler:    cfg.handlerLogin,
+			body:       `{"email": 42, "password": "x"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeInvalidJSON,
+			wantFields: []string{"email"},
+		},
+		{
+			name:       "trailing data",
+			handler:    cfg.handlerLogin,
+			body:       `{"email": "a@example.com", "password": "x"} {}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codeInvalidJSON,
+		},
+		{
+			name:       "body too large",
+			handler:    cfg.handlerLogin,
+			body:       `{"email": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   codePayloadTooLarge,
+		},
+		{
+			name:       "malformed UUID",
+			handler:    decodeInto(&startConversationRequest{}),
+			body:       `{"recipient_id": "nope"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"recipient_id"},
+		},
+		{
+			name:       "malformed timestamp",
+			handler:    decodeInto(&addChirpRequest{}),
+			body:       `{"body": "hi", "publish_at": "tomorrow"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeValidationFailed,
+			wantFields: []string{"publish_at"},
+		},
+		{
+			name:        "not JSON content type",
+			handler:     cfg.handlerLogin,
+			contentType: "application/x-www-form-urlencoded",
+			body:        `email=a@example.com`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    "unsupported_media_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != problemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, problemContentType)
+			}
+			var problem errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("Error decoding problem - %v", err)
+			}
+			if problem.Code != tt.wantCode || problem.Status != tt.wantStatus || problem.Instance != "/api/users" || problem.Error != problem.Detail {
+				t.Errorf("problem = %+v", problem)
+			}
+			var fields []string
+			for _, fieldErr := range problem.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("field errors = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestErrorDetail(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: entitlements.ErrChirpTooLong, want: "Chirp is too long"},
+		{err: entitlements.ErrScheduleNotInFuture, want: "publish_at must be in the future"},
+		{err: errors.New("état inconnu"), want: "État inconnu"},
+	}
+	for _, tt := range tests {
+		if got := errorDetail(tt.err); got != tt.want {
+			t.Errorf("errorDetail(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	cfg := &apiConfig{}
+	mux := http.NewServeMux()
+	routes := cfg.routes()
+	for _, route := range routes {
+		mux.Handle(route.pattern, route.handler)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]map[string]any  `json:"paths"`
+		Components map[string]map[string]json.RawMessage `json:"components"`
+	}
+	body := rec.Body.Bytes()
+	if err := json.Unmarshal(body, &spec); err != nil {
+		t.Fatalf("decoding spec: %s", err)
+	}
+	if spec.OpenAPI != openAPIVersion {
+		t.Errorf("openapi = %q, want %q", spec.OpenAPI, openAPIVersion)
+	}
+
+	operations := 0
+	operationIDs := map[string]bool{}
+	for _, pathItem := range spec.Paths {
+		for _, operation := range pathItem {
+			operations++
+			id, _ := operation["operationId"].(string)
+			if id == "" || operationIDs[id] {
+				t.Errorf("operationId %q is missing or not unique", id)
+			}
+			operationIDs[id] = true
+		}
+	}
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route.pattern, " ")
+		if !ok {
+			t.Errorf("route %q has no method", route.pattern)
+			continue
+		}
+		if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is missing from the OpenAPI document", route.pattern)
+		}
+	}
+	if operations != len(routes) {
+		t.Errorf("document has %d operations for %d routes", operations, len(routes))
+	}
+
+	for _, match := range regexp.MustCompile(`"\$ref":"#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(body), -1) {
+		if _, ok := spec.Components[match[1]][match[2]]; !ok {
+			t.Errorf("reference to missing component %s/%s", match[1], match[2])
+		}
+	}
+	for _, name := range []string{"User", "Chirp", "errorResponse"} {
+		if _, ok := spec.Components["schemas"][name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	var createUser struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Format string `json:"format"`
+		} `json:"properties"`
+	}
+	json.Unmarshal(spec.Components["schemas"]["createUserRequest"], &createUser)
+	if strings.Join(createUser.Required, ",") != "password,email" || createUser.Properties["email"].Format != "email" {
+		t.Errorf("createUserRequest schema = %+v", createUser)
+	}
+}
+
+func TestOpenAPISchemaDirections(t *testing.T) {
+	type profile struct {
+		Name string `json:"name" validate:"required"`
+		Bio  string `json:"bio"`
+	}
+	schemas := &schemaBuilder{components: map[string]jsonSchema{}, names: map[componentKey]string{}}
+	response := schemas.response(reflect.TypeFor[profile]())
+	request := schemas.request(reflect.TypeFor[profile]())
+	if response["$ref"] == request["$ref"] {
+		t.Fatalf("request and response share the component %v", request["$ref"])
+	}
+	tests := []struct {
+		name         string
+		wantRequired []string
+	}{
+		{name: "profile", wantRequired: []string{"name", "bio"}},
+		{name: "profileRequest", wantRequired: []string{"name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := schemas.components[tt.name]["required"].([]string)
+			if !slices.Equal(got, tt.wantRequired) {
+				t.Errorf("required = %v, want %v", got, tt.wantRequired)
+			}
+		})
+	}
+
+	first, _ := json.Marshal(buildOpenAPISpec())
+	for range 5 {
+		if again, _ := json.Marshal(buildOpenAPISpec()); !bytes.Equal(first, again) {
+			t.Fatalf("the OpenAPI document differs between builds")
+		}
+	}
+}
+
+func TestQueryValidation(t *testing.T) {
+	cfg := &apiConfig{}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		field   string
+	}{
+		{name: "chirps author_id", handler: cfg.handlerChirps, target: "/api/chirps?author_id=nope", field: "author_id"},
+		{name: "chirps sort", handler: cfg.handlerChirps, target: "/api/chirps?sort=sideways", field: "sort"},
+		{name: "reports reported_user_id", handler: cfg.handlerAdminReports, target: "/admin/reports?reported_user_id=nope", field: "reported_user_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest("GET", tt.target, nil))
+			var problem errorResponse
+			json.NewDecoder(rec.Body).Decode(&problem)
+			if rec.Code != http.StatusUnprocessableEntity || len(problem.Errors) != 1 || problem.Errors[0].Field != tt.field {
+				t.Errorf("response = %d %+v, want a validation error for %s", rec.Code, problem, tt.field)
+			}
+		})
+	}
+}
+
+// TestClientErrorCodes checks that the client's Code constants match the
+// codes the server sends.
+func TestClientErrorCodes(t *testing.T) {
+	codes := func(path, prefix string) map[string]string {
+		t.Helper()
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			t.Fatalf("parsing %s: %s", path, err)
+		}
+		result := map[string]string{}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, name := range value.Names {
+					code, ok := strings.CutPrefix(name.Name, prefix)
+					if !ok || i >= len(value.Values) {
+						continue
+					}
+					if literal, ok := value.Values[i].(*ast.BasicLit); ok && literal.Kind == token.STRING {
+						result[code], _ = strconv.Unquote(literal.Value)
+					}
+				}
+			}
+		}
+		return result
+	}
+	server := codes("problems.go", "code")
+	client := codes("client/errors.go", "Code")
+	if len(server) == 0 {
+		t.Fatalf("no error codes found in problems.go")
+	}
+	if !maps.Equal(server, client) {
+		t.Errorf("client codes = %v, want the server codes %v", client, server)
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		mailer   string
+		from     string
+		platform string
+		wantErr  bool
+	}{
+		{name: "log on dev by default", platform: "dev"},
+		{name: "unset in production", wantErr: true},
+		{name: "explicit log in production", mailer: "log"},
+		{name: "smtp", mailer: "smtp"},
+		{name: "smtp with a sender", mailer: "smtp", from: "no-reply@example.com"},
+		{name: "invalid sender", mailer: "smtp", from: "Chirpy", wantErr: true},
+		{name: "unknown", mailer: "carrier-pigeon", platform: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAILER", tt.mailer)
+			t.Setenv("MAIL_FROM", tt.from)
+			t.Setenv("MAIL_LOG_FILE", "")
+			if _, err := newMailer(tt.platform); (err != nil) != tt.wantErr {
+				t.Errorf("newMailer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		wantErr bool
+	}{
+		{email: "user@example.com", wantErr: false},
+		{email: "first.last+tag@example.co.uk", wantErr: false},
+		{email: "", wantErr: true},
+		{email: "not-an-email", wantErr: true},
+		{email: "User <user@example.com>", wantErr: true},
+		{email: " user@example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateEmail(tt.email); (err != nil) != tt.wantErr {
+			t.Errorf("validateEmail(%q) error = %v, wantErr %v", tt.email, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+type Conversation struct {
+	ID             uuid.UUID   `json:"id"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	ParticipantIDs []uuid.UUID `json:"participant_ids"`
+}
+type Message struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+const maxMessageLength int = 1000
+
+type startConversationRequest struct {
+	RecipientID string `json:"recipient_id" validate:"required,uuid"`
+}
+
+func (cfg *apiConfig) handlerStartConversation(writer http.ResponseWriter, req *http.Request) {
+	var requestData startConversationRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	recipientID := uuid.MustParse(requestData.RecipientID)
+	if recipientID == userID {
+		writeValidationError(writer, req, invalidField("recipient_id", "Cannot start a conversation with yourself"))
+		return
+	}
+	if _, ok := cfg.requireActiveAccount(writer, req, userID); !ok {
+		return
+	}
+	if _, err := cfg.db.GetUserByID(req.Context(), recipientID); err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	blocked, err := cfg.isBlockedBetween(req, userID, recipientID)
+	if err != nil {
+		log.Printf("Error checking blocks: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if blocked {
+		writeErrorResponse(writer, req, http.StatusForbidden, "Cannot message this user")
+		return
+	}
+	userOneID, userTwoID := orderParticipants(userID, recipientID)
+	conversation, err := cfg.db.GetConversationByParticipants(req.Context(), database.GetConversationByParticipantsParams{
+		UserOneID: userOneID,
+		UserTwoID: userTwoID,
+	})
+	if err == nil {
+		writeJSONResponse(writer, http.StatusOK, conversationFromDB(conversation))
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error getting conversation from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	conversation, err = cfg.db.CreateConversation(req.Context(), database.CreateConversationParams{
+		UserOneID: userOneID,
+		UserTwoID: userTwoID,
+	})
+	if err != nil {
+		log.Printf("Error creating conversation: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusCreated, conversationFromDB(conversation))
+}
+
+func (cfg *apiConfig) handlerConversations(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	conversations, err := cfg.db.GetConversationsForUser(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting conversations from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	resultConversations := []Conversation{}
+	for _, conversation := range conversations {
+		resultConversations = append(resultConversations, conversationFromDB(conversation))
+	}
+	writeJSONResponse(writer, http.StatusOK, resultConversations)
+}
+
+func (cfg *apiConfig) handlerMessages(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	conversation, ok := cfg.conversationForParticipant(writer, req, userID)
+	if !ok {
+		return
+	}
+	messages, err := cfg.db.GetMessagesByConversation(req.Context(), conversation.ID)
+	if err != nil {
+		log.Printf("Error getting messages from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	resultMessages := []Message{}
+	for _, message := range messages {
+		resultMessages = append(resultMessages, messageFromDB(message))
+	}
+	writeJSONResponse(writer, http.StatusOK, resultMessages)
+}
+
+type sendMessageRequest struct {
+	Body string `json:"body" validate:"required"`
+}
+
+func (cfg *apiConfig) handlerSendMessage(writer http.ResponseWriter, req *http.Request) {
+	var requestData sendMessageRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(writer, req, user) {
+		return
+	}
+	conversation, ok := cfg.conversationForParticipant(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if len(requestData.Body) > maxMessageLength {
+		writeValidationError(writer, req, invalidField("body", "Message is too long"))
+		return
+	}
+	recipientID := conversation.UserOneID
+	if recipientID == userID {
+		recipientID = conversation.UserTwoID
+	}
+	blocked, err := cfg.isBlockedBetween(req, userID, recipientID)
+	if err != nil {
+		log.Printf("Error checking blocks: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if blocked {
+		writeErrorResponse(writer, req, http.StatusForbidden, "Cannot message this user")
+		return
+	}
+	body := requestData.Body
+	if cfg.filterMessageProfanity {
+		body = hideProfanity(body)
+	}
+	message, err := cfg.db.CreateMessage(req.Context(), database.CreateMessageParams{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+		Body:           body,
+	})
+	if err != nil {
+		log.Printf("Error creating message: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := cfg.db.TouchConversation(req.Context(), conversation.ID); err != nil {
+		log.Printf("Error updating conversation: %s", err)
+	}
+	writeJSONResponse(writer, http.StatusCreated, messageFromDB(message))
+}
+
+func (cfg *apiConfig) handlerMarkMessagesRead(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	conversation, ok := cfg.conversationForParticipant(writer, req, userID)
+	if !ok {
+		return
+	}
+	if err := cfg.db.MarkMessagesRead(req.Context(), database.MarkMessagesReadParams{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+	}); err != nil {
+		log.Printf("Error marking messages as read: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// conversationForParticipant loads the conversation from the request path and
+// writes an error response unless userID is one of its participants.
+func (cfg *apiConfig) conversationForParticipant(writer http.ResponseWriter, req *http.Request, userID uuid.UUID) (database.Conversation, bool) {
+	conversationID, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		log.Printf("Error parsing conversationID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return database.Conversation{}, false
+	}
+	conversation, err := cfg.db.GetConversationByID(req.Context(), conversationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+			return database.Conversation{}, false
+		}
+		log.Printf("Error getting conversation from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return database.Conversation{}, false
+	}
+	if conversation.UserOneID != userID && conversation.UserTwoID != userID {
+		// Non-participants get the same response as a missing conversation.
+		writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+		return database.Conversation{}, false
+	}
+	return conversation, true
+}
+
+// orderParticipants returns the two IDs in the order required by the
+// conversations table so that each pair of users maps to a single row.
+func orderParticipants(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if bytes.Compare(a[:], b[:]) < 0 {
+		return a, b
+	}
+	return b, a
+}
+
+func conversationFromDB(conversation database.Conversation) Conversation {
+	return Conversation{
+		ID:             conversation.ID,
+		CreatedAt:      conversation.CreatedAt,
+		UpdatedAt:      conversation.UpdatedAt,
+		ParticipantIDs: []uuid.UUID{conversation.UserOneID, conversation.UserTwoID},
+	}
+}
+
+func messageFromDB(message database.Message) Message {
+	result := Message{
+		ID:             message.ID,
+		CreatedAt:      message.CreatedAt,
+		UpdatedAt:      message.UpdatedAt,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+	}
+	if message.ReadAt.Valid {
+		result.ReadAt = &message.ReadAt.Time
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+const notificationKindReportResolved = "report_resolved"
+
+func (cfg *apiConfig) handlerNotifications(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	notifications, err := cfg.db.GetNotificationsForUser(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting notifications from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []Notification{}
+	for _, notification := range notifications {
+		result = append(result, notificationFromDB(notification))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerMarkNotificationsRead(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if err := cfg.db.MarkNotificationsRead(req.Context(), userID); err != nil {
+		log.Printf("Error marking notifications as read: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func notificationFromDB(notification database.Notification) Notification {
+	result := Notification{
+		ID:        notification.ID,
+		CreatedAt: notification.CreatedAt,
+		Kind:      notification.Kind,
+		Body:      notification.Body,
+	}
+	if notification.ReadAt.Valid {
+		result.ReadAt = &notification.ReadAt.Time
+	}
+	return result
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+	"github.com/panaiotuzunov/Chirpy/internal/scopes"
+)
+
+var errOAuthTokenInactive = errors.New("OAuth token is revoked or expired")
+
+// OAuthClient is a third-party application registered by a user. Secret is
+// only set in the response that creates a confidential client.
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+// OAuthConsent describes an authorization request so the app can ask the user
+// to approve it.
+type OAuthConsent struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is the RFC 7662 introspection response. Only Active is
+// set for tokens that are not active.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+type oauthAuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,max=10"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(writer http.ResponseWriter, req *http.Request) {
+	var requestData createOAuthClientRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if _, ok := cfg.requireActiveAccount(writer, req, userID); !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	for _, uri := range requestData.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			writeValidationError(writer, req, invalidField("redirect_uris", errorDetail(err)))
+			return
+		}
+	}
+	clientScopes, err := scopes.Normalize(requestData.Scopes)
+	if err != nil {
+		writeValidationError(writer, req, invalidField("scopes", errorDetail(err)))
+		return
+	}
+	secret := ""
+	secretHash := sql.NullString{}
+	if requestData.Confidential {
+		secret, err = oauth.MakeClientSecret()
+		if err != nil {
+			log.Printf("Error generating client secret: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	client, err := cfg.db.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		OwnerID:      userID,
+		Name:         requestData.Name,
+		SecretHash:   secretHash,
+		RedirectUris: requestData.RedirectURIs,
+		Scopes:       clientScopes,
+	})
+	if err != nil {
+		log.Printf("Error creating OAuth client: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := oauthClientFromDB(client)
+	result.Secret = secret
+	writeJSONResponse(writer, http.StatusCreated, result)
+}
+
+func (cfg *apiConfig) handlerOAuthClients(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	clients, err := cfg.db.GetOAuthClientsByOwner(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting OAuth clients from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []OAuthClient{}
+	for _, client := range clients {
+		result = append(result, oauthClientFromDB(client))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// handlerDeleteOAuthClient removes a client along with every code and token
+// issued to it.
+func (cfg *apiConfig) handlerDeleteOAuthClient(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	deleted, err := cfg.db.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+		ID:      req.PathValue("clientID"),
+		OwnerID: userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting OAuth client: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if deleted == 0 {
+		writeErrorResponse(writer, req, http.StatusNotFound, "Client not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// handlerOAuthConsent validates an authorization request from the query string
+// and describes it, so the app can show the user what they are approving.
+func (cfg *apiConfig) handlerOAuthConsent(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if _, ok := cfg.requireActiveAccount(writer, req, userID); !ok {
+		return
+	}
+	query := req.URL.Query()
+	authRequest := oauthAuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	client, err := cfg.authorizationClient(req.Context(), authRequest)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	grantedScopes, err := authorizationScopes(client, authRequest)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, OAuthConsent{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		RedirectURI: authRequest.RedirectURI,
+		Scopes:      grantedScopes,
+	})
+}
+
+// OAuthRedirect is where the app sends the browser after the user approves
+// or denies an authorization request.
+type OAuthRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type oauthAuthorizeRequest struct {
+	oauthAuthorizationRequest
+	Approve bool `json:"approve"`
+}
+
+// handlerOAuthAuthorize records the user's decision on an authorization
+// request and returns the URL to send the browser to. Once the client and
+// redirect URI are known to be valid, every outcome, including errors, is
+// reported to the client through that redirect.
+func (cfg *apiConfig) handlerOAuthAuthorize(writer http.ResponseWriter, req *http.Request) {
+	var requestData oauthAuthorizeRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if _, ok := cfg.requireActiveAccount(writer, req, userID); !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	authRequest := requestData.oauthAuthorizationRequest
+	client, err := cfg.authorizationClient(req.Context(), authRequest)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	params := url.Values{}
+	if authRequest.State != "" {
+		params.Set("state", authRequest.State)
+	}
+	grantedScopes, err := authorizationScopes(client, authRequest)
+	if err == nil && !requestData.Approve {
+		err = oauth.Error{Code: oauth.ErrAccessDenied, Description: "The user denied the request"}
+	}
+	if err == nil {
+		var code string
+		code, err = cfg.createAuthorizationCode(req.Context(), client, userID, authRequest, grantedScopes)
+		params.Set("code", code)
+	}
+	if err != nil {
+		var oauthErr oauth.Error
+		if !errors.As(err, &oauthErr) {
+			log.Printf("Error creating authorization code: %s", err)
+			oauthErr = oauth.Error{Code: oauth.ErrServerError}
+		}
+		params.Del("code")
+		params.Set("error", oauthErr.Code)
+		if oauthErr.Description != "" {
+			params.Set("error_description", oauthErr.Description)
+		}
+	}
+	redirectTo, err := oauth.RedirectURL(authRequest.RedirectURI, params)
+	if err != nil {
+		log.Printf("Error building redirect URL: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, OAuthRedirect{
+		RedirectTo: redirectTo,
+	})
+}
+
+// authorizationClient loads the client of an authorization request and checks
+// the redirect URI against the ones it registered. Errors here must not be
+// redirected, since the redirect URI cannot be trusted.
+func (cfg *apiConfig) authorizationClient(ctx context.Context, authRequest oauthAuthorizationRequest) (database.OauthClient, error) {
+	client, err := cfg.db.GetOAuthClientByID(ctx, authRequest.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return database.OauthClient{}, oauth.Error{Code: oauth.ErrInvalidClient, Description: "Unknown client_id"}
+		}
+		return database.OauthClient{}, err
+	}
+	if !slices.Contains(client.RedirectUris, authRequest.RedirectURI) {
+		return database.OauthClient{}, oauth.Error{Code: oauth.ErrInvalidRequest, Description: "redirect_uri is not registered for this client"}
+	}
+	return client, nil
+}
+
+// authorizationScopes checks the rest of an authorization request and returns
+// the scopes to grant. Without a scope parameter every scope the client
+// registered is requested.
+func authorizationScopes(client database.OauthClient, authRequest oauthAuthorizationRequest) ([]string, error) {
+	if authRequest.ResponseType != "code" {
+		return nil, oauth.Error{Code: oauth.ErrUnsupportedResponseType, Description: "response_type must be code"}
+	}
+	if err := oauth.ValidateCodeChallenge(authRequest.CodeChallenge, authRequest.CodeChallengeMethod); err != nil {
+		return nil, err
+	}
+	requested := oauth.ParseScope(authRequest.Scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	grantedScopes, err := scopes.Normalize(requested)
+	if err != nil {
+		return nil, oauth.Error{Code: oauth.ErrInvalidScope, Description: errorDetail(err)}
+	}
+	for _, scope := range grantedScopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, oauth.Error{Code: oauth.ErrInvalidScope, Description: "Client is not allowed the " + scope + " scope"}
+		}
+	}
+	return grantedScopes, nil
+}
+
+func (cfg *apiConfig) createAuthorizationCode(ctx context.Context, client database.OauthClient, userID uuid.UUID, authRequest oauthAuthorizationRequest, grantedScopes []string) (string, error) {
+	code, err := oauth.MakeCode()
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		GrantID:       uuid.New(),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectUri:   authRequest.RedirectURI,
+		Scopes:        grantedScopes,
+		CodeChallenge: authRequest.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauth.AuthorizationCodeExpiration),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// handlerOAuthToken is the token endpoint. It exchanges authorization codes
+// and rotates refresh tokens; a refresh token can only be used once.
+func (cfg *apiConfig) handlerOAuthToken(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Cache-Control", "no-store")
+	client, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	var response OAuthTokenResponse
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		response, err = cfg.exchangeAuthorizationCode(req, client)
+	case "refresh_token":
+		response, err = cfg.refreshOAuthToken(req, client)
+	default:
+		err = oauth.Error{Code: oauth.ErrUnsupportedGrantType}
+	}
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(req *http.Request, client database.OauthClient) (OAuthTokenResponse, error) {
+	invalidGrant := oauth.Error{Code: oauth.ErrInvalidGrant, Description: "Invalid authorization code"}
+	code, err := cfg.db.GetOAuthAuthorizationCode(req.Context(), auth.HashToken(req.PostForm.Get("code")))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthTokenResponse{}, invalidGrant
+		}
+		return OAuthTokenResponse{}, err
+	}
+	if code.ClientID != client.ID {
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	// A code being replayed may have been stolen, so everything issued
+	// from it is revoked (RFC 6749 section 4.1.2).
+	if code.UsedAt.Valid {
+		if err := cfg.db.RevokeOAuthGrant(req.Context(), code.GrantID); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	if time.Now().After(code.ExpiresAt) || code.RedirectUri != req.PostForm.Get("redirect_uri") {
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	if !oauth.VerifyPKCE(req.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		return OAuthTokenResponse{}, oauth.Error{Code: oauth.ErrInvalidGrant, Description: "Invalid code_verifier"}
+	}
+	if err := cfg.requireActiveOAuthUser(req.Context(), code.UserID); err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	used, err := qtx.UseOAuthAuthorizationCode(req.Context(), code.CodeHash)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if used == 0 {
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	response, err := issueOAuthTokens(req.Context(), qtx, code.GrantID, client.ID, code.UserID, code.Scopes)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	return response, tx.Commit()
+}
+
+func (cfg *apiConfig) refreshOAuthToken(req *http.Request, client database.OauthClient) (OAuthTokenResponse, error) {
+	invalidGrant := oauth.Error{Code: oauth.ErrInvalidGrant, Description: "Invalid refresh token"}
+	token, err := cfg.db.GetOAuthToken(req.Context(), auth.HashToken(req.PostForm.Get("refresh_token")))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthTokenResponse{}, invalidGrant
+		}
+		return OAuthTokenResponse{}, err
+	}
+	if token.TokenType != oauth.TokenTypeRefresh || token.ClientID != client.ID {
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	// Refresh tokens rotate on every use, so a revoked one being presented
+	// again means it leaked. The whole grant is revoked.
+	if token.RevokedAt.Valid {
+		if err := cfg.db.RevokeOAuthGrant(req.Context(), token.GrantID); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	grantedScopes := token.Scopes
+	if requested := oauth.ParseScope(req.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(token.Scopes, scope) {
+				return OAuthTokenResponse{}, oauth.Error{Code: oauth.ErrInvalidScope, Description: "Scope exceeds the original grant"}
+			}
+		}
+		grantedScopes, _ = scopes.Normalize(requested)
+	}
+	if err := cfg.requireActiveOAuthUser(req.Context(), token.UserID); err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	revoked, err := qtx.RevokeOAuthToken(req.Context(), token.TokenHash)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	// Another request rotated the token first, so it was presented twice.
+	if revoked == 0 {
+		if err := qtx.RevokeOAuthGrant(req.Context(), token.GrantID); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		return OAuthTokenResponse{}, invalidGrant
+	}
+	response, err := issueOAuthTokens(req.Context(), qtx, token.GrantID, client.ID, token.UserID, grantedScopes)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	return response, tx.Commit()
+}
+
+func issueOAuthTokens(ctx context.Context, qtx *database.Queries, grantID uuid.UUID, clientID string, userID uuid.UUID, grantedScopes []string) (OAuthTokenResponse, error) {
+	accessToken, err := oauth.MakeAccessToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	refreshToken, err := oauth.MakeRefreshToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	now := time.Now().UTC()
+	for _, token := range []database.CreateOAuthTokenParams{
+		{
+			TokenHash: auth.HashToken(accessToken),
+			TokenType: oauth.TokenTypeAccess,
+			ExpiresAt: now.Add(oauth.AccessTokenExpiration),
+		},
+		{
+			TokenHash: auth.HashToken(refreshToken),
+			TokenType: oauth.TokenTypeRefresh,
+			ExpiresAt: now.Add(oauth.RefreshTokenExpiration),
+		},
+	} {
+		token.GrantID = grantID
+		token.ClientID = clientID
+		token.UserID = userID
+		token.Scopes = grantedScopes
+		if err := qtx.CreateOAuthToken(ctx, token); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+	}
+	return OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauth.AccessTokenExpiration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        oauth.FormatScope(grantedScopes),
+	}, nil
+}
+
+// handlerOAuthIntrospect implements RFC 7662. Clients can only introspect
+// their own tokens; any other token is reported as inactive.
+func (cfg *apiConfig) handlerOAuthIntrospect(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Cache-Control", "no-store")
+	client, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	token, err := cfg.db.GetOAuthToken(req.Context(), auth.HashToken(req.PostForm.Get("token")))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			writeOAuthError(writer, err)
+			return
+		}
+		writeJSONResponse(writer, http.StatusOK, OAuthIntrospection{Active: false})
+		return
+	}
+	if token.ClientID != client.ID || token.RevokedAt.Valid || time.Now().After(token.ExpiresAt) {
+		writeJSONResponse(writer, http.StatusOK, OAuthIntrospection{Active: false})
+		return
+	}
+	tokenType := "refresh_token"
+	if token.TokenType == oauth.TokenTypeAccess {
+		tokenType = "Bearer"
+	}
+	writeJSONResponse(writer, http.StatusOK, OAuthIntrospection{
+		Active:    true,
+		Scope:     oauth.FormatScope(token.Scopes),
+		ClientID:  token.ClientID,
+		Subject:   token.UserID.String(),
+		TokenType: tokenType,
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+	})
+}
+
+// handlerOAuthRevoke implements RFC 7009. Revoking a refresh token also
+// revokes the access tokens issued from the same grant. Unknown tokens are not
+// an error.
+func (cfg *apiConfig) handlerOAuthRevoke(writer http.ResponseWriter, req *http.Request) {
+	client, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		writeOAuthError(writer, err)
+		return
+	}
+	token, err := cfg.db.GetOAuthToken(req.Context(), auth.HashToken(req.PostForm.Get("token")))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			writeOAuthError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+	if token.ClientID == client.ID {
+		if token.TokenType == oauth.TokenTypeRefresh {
+			err = cfg.db.RevokeOAuthGrant(req.Context(), token.GrantID)
+		} else {
+			_, err = cfg.db.RevokeOAuthToken(req.Context(), token.TokenHash)
+		}
+		if err != nil {
+			writeOAuthError(writer, err)
+			return
+		}
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+// authenticateOAuthClient parses the form body and identifies the client from
+// HTTP Basic credentials or the client_id and client_secret parameters.
+// Public clients have no secret and rely on PKCE instead.
+func (cfg *apiConfig) authenticateOAuthClient(req *http.Request) (database.OauthClient, error) {
+	invalidClient := oauth.Error{Code: oauth.ErrInvalidClient, Description: "Client authentication failed"}
+	if err := req.ParseForm(); err != nil {
+		return database.OauthClient{}, oauth.Error{Code: oauth.ErrInvalidRequest, Description: "Invalid form body"}
+	}
+	clientID, secret, ok := req.BasicAuth()
+	if !ok {
+		clientID = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+	client, err := cfg.db.GetOAuthClientByID(req.Context(), clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return database.OauthClient{}, invalidClient
+		}
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, invalidClient
+		}
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) requireActiveOAuthUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := accountStatusError(user); err != nil {
+		return oauth.Error{Code: oauth.ErrInvalidGrant, Description: errorDetail(err)}
+	}
+	return nil
+}
+
+// oauthAccessToken looks up an active OAuth access token by its plaintext
+// value.
+func (cfg *apiConfig) oauthAccessToken(ctx context.Context, tokenString string) (database.OauthToken, error) {
+	token, err := cfg.db.GetOAuthToken(ctx, auth.HashToken(tokenString))
+	if err != nil {
+		return database.OauthToken{}, err
+	}
+	if token.TokenType != oauth.TokenTypeAccess || token.RevokedAt.Valid || time.Now().After(token.ExpiresAt) {
+		return database.OauthToken{}, errOAuthTokenInactive
+	}
+	return token, nil
+}
+
+// writeOAuthError writes err in the RFC 6749 error format. Anything that is
+// not an oauth.Error is reported as a server error.
+func writeOAuthError(writer http.ResponseWriter, err error) {
+	var oauthErr oauth.Error
+	if !errors.As(err, &oauthErr) {
+		log.Printf("Error handling OAuth request: %s", err)
+		writeJSONResponse(writer, http.StatusInternalServerError, oauth.Error{Code: oauth.ErrServerError})
+		return
+	}
+	status := http.StatusBadRequest
+	if oauthErr.Code == oauth.ErrInvalidClient {
+		status = http.StatusUnauthorized
+	}
+	writeJSONResponse(writer, status, oauthErr)
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		CreatedAt:    client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/oidc"
+)
+
+const (
+	oidcLoginStateExpiration = 10 * time.Minute
+	// oidcBrowserCookie holds a secret that ties a login state to the
+	// browser that started the login, so a state issued to one browser
+	// cannot be completed in another.
+	oidcBrowserCookie = "chirpy_oidc_browser"
+	oidcCookiePath    = "/api/login/oidc"
+)
+
+var (
+	errOIDCNotConfigured = errors.New("single sign-on is not configured")
+	errOIDCLoginFailed   = errors.New("single sign-on failed")
+	errOIDCEmailMissing  = errors.New("the identity provider did not share a valid email address")
+	errOIDCEmailConflict = errors.New("an account with this email already exists")
+)
+
+// newOIDCRelyingParty configures single sign-on from OIDC_ISSUER,
+// OIDC_CLIENT_ID and OIDC_CLIENT_SECRET. It returns nil when OIDC_ISSUER is
+// not set. The provider redirects back to OIDC_REDIRECT_URL, by default the
+// web app's callback page, which posts the code and state to
+// handlerOIDCCallback.
+func newOIDCRelyingParty(publicURL string) *oidc.RelyingParty {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = publicURL + "/app/login/oidc/callback"
+	}
+	return oidc.New(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"email"},
+	})
+}
+
+// OIDCAuthorization is the provider URL that starts a single sign-on login.
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// handlerOIDCLogin starts a single sign-on login and returns the provider URL
+// to send the browser to. The browser also gets a cookie that
+// handlerOIDCCallback requires along with the state.
+func (cfg *apiConfig) handlerOIDCLogin(writer http.ResponseWriter, req *http.Request) {
+	if cfg.oidc == nil {
+		writeErrorResponse(writer, req, http.StatusNotFound, errorDetail(errOIDCNotConfigured))
+		return
+	}
+	var secrets [4]string
+	for i := range secrets {
+		value, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error generating OIDC login state: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		secrets[i] = value
+	}
+	state, nonce, codeVerifier, browser := secrets[0], secrets[1], secrets[2], secrets[3]
+	if err := cfg.db.DeleteExpiredOIDCLoginStates(req.Context()); err != nil {
+		log.Printf("Error deleting expired OIDC login states: %s", err)
+	}
+	if err := cfg.db.CreateOIDCLoginState(req.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginStateExpiration),
+		BrowserHash:  auth.HashToken(browser),
+	}); err != nil {
+		log.Printf("Error saving OIDC login state: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	authorizationURL, err := cfg.oidc.AuthorizationURL(req.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("Error building OIDC authorization URL: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadGateway, errorDetail(errOIDCLoginFailed))
+		return
+	}
+	cfg.setOIDCBrowserCookie(writer, browser, oidcLoginStateExpiration)
+	writeJSONResponse(writer, http.StatusOK, OIDCAuthorization{
+		AuthorizationURL: authorizationURL,
+	})
+}
+
+// setOIDCBrowserCookie sets the login cookie, or clears it when maxAge is
+// negative. It is only sent to the login endpoints.
+func (cfg *apiConfig) setOIDCBrowserCookie(writer http.ResponseWriter, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     oidcBrowserCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(writer, cookie)
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// handlerOIDCCallback finishes a single sign-on login with the code and state
+// the provider redirected back with, posted by the browser that started it.
+// The external identity is linked to a Chirpy account, creating one on first
+// login, and normal Chirpy tokens are issued. Accounts with 2FA still have to
+// pass it.
+func (cfg *apiConfig) handlerOIDCCallback(writer http.ResponseWriter, req *http.Request) {
+	var requestData oidcCallbackRequest
+	if cfg.oidc == nil {
+		writeErrorResponse(writer, req, http.StatusNotFound, errorDetail(errOIDCNotConfigured))
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	browser, err := req.Cookie(oidcBrowserCookie)
+	if err != nil {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid or expired state")
+		return
+	}
+	cfg.setOIDCBrowserCookie(writer, "", -1)
+	loginState, err := cfg.db.UseOIDCLoginState(req.Context(), database.UseOIDCLoginStateParams{
+		StateHash:   auth.HashToken(requestData.State),
+		BrowserHash: auth.HashToken(browser.Value),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid or expired state")
+			return
+		}
+		log.Printf("Error using OIDC login state: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	claims, err := cfg.oidc.Exchange(req.Context(), requestData.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("Error completing OIDC login: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, errorDetail(errOIDCLoginFailed))
+		return
+	}
+	user, err := cfg.userForIdentity(req.Context(), claims)
+	if err != nil {
+		switch err {
+		case errOIDCEmailMissing:
+			writeErrorResponse(writer, req, http.StatusBadRequest, errorDetail(err))
+		case errOIDCEmailConflict:
+			writeErrorResponse(writer, req, http.StatusConflict, errorDetail(err)+". Log in with your password first.")
+		default:
+			log.Printf("Error linking OIDC identity: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		}
+		return
+	}
+	if err := accountStatusError(user); err != nil {
+		writeCodedErrorResponse(writer, req, http.StatusForbidden, codeAccountUnavailable, errorDetail(err))
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		mfaToken, err := auth.MakeMFAChallengeToken(user.ID, cfg.secret, mfaChallengeExpiration)
+		if err != nil {
+			log.Printf("Error creating MFA challenge token: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		writeJSONResponse(writer, http.StatusOK, MFAChallenge{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+	result, err := cfg.issueTokens(req, user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// userForIdentity returns the user linked to the provider's subject. An
+// unlinked identity is linked to the account with the same email only when
+// both the provider and Chirpy have verified that address; otherwise anyone
+// who registered the address first could share the account. With no such
+// account, a new one is created without a usable password.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, claims oidc.Claims) (database.User, error) {
+	identity, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  cfg.oidc.Issuer(),
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if err := cfg.db.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:    identity.ID,
+			Email: claims.Email,
+		}); err != nil {
+			log.Printf("Error updating user identity: %s", err)
+		}
+		return cfg.db.GetUserByID(ctx, identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return database.User{}, err
+	}
+	email := strings.TrimSpace(claims.Email)
+	if validateEmail(email) != nil {
+		return database.User{}, errOIDCEmailMissing
+	}
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	user, err := qtx.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if !bool(claims.EmailVerified) || !user.EmailVerifiedAt.Valid {
+			return database.User{}, errOIDCEmailConflict
+		}
+	case err == sql.ErrNoRows:
+		user, err = cfg.createOIDCUser(ctx, qtx, email, bool(claims.EmailVerified))
+		if err != nil {
+			return database.User{}, err
+		}
+	default:
+		return database.User{}, err
+	}
+	if err := qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  cfg.oidc.Issuer(),
+		Subject: claims.Subject,
+		Email:   email,
+	}); err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+// createOIDCUser creates an account whose password is random and never
+// disclosed. The user can set one later through the password reset flow.
+func (cfg *apiConfig) createOIDCUser(ctx context.Context, qtx *database.Queries, email string, emailVerified bool) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := qtx.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if emailVerified {
+		return qtx.VerifyEmail(ctx, database.VerifyEmailParams{Email: email, ID: user.ID})
+	}
+	return user, nil
+}
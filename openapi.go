@@ -0,0 +1,1122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+	"github.com/panaiotuzunov/Chirpy/internal/scopes"
+)
+
+// The OpenAPI document is built from openAPIOperations. Request and response
+// schemas are generated from the Go types named there, so their fields match
+// the code, but the operations and the types they use are listed by hand and
+// must be updated along with the routes and handlers. TestOpenAPISpec checks
+// that every route is documented.
+
+const openAPIVersion = "3.1.0"
+
+// authRequirement is how an operation authenticates its caller.
+type authRequirement int
+
+const (
+	authNone authRequirement = iota
+	// authBearer is an access token, or a refresh token for the endpoints
+	// that exchange one.
+	authBearer
+	// authOptionalBearer is a public operation whose response depends on
+	// the caller when there is one.
+	authOptionalBearer
+	authPolka
+	authOAuthClient
+)
+
+// oneOf documents a response that is one of several types.
+type oneOf []any
+
+// operationDoc describes one route for the OpenAPI document. request, query
+// and response are zero values of the types involved.
+type operationDoc struct {
+	id          string
+	summary     string
+	description string
+	tag         string
+	auth        authRequirement
+	// scope is the scope personal access and OAuth tokens need. Without one
+	// such tokens are refused.
+	scope string
+	role  string
+	query any
+	// request is read from a form body when form is set, JSON otherwise.
+	request any
+	form    bool
+	status  int
+	// response is the body written with status, if any. contentType is set
+	// for bodies that are not JSON.
+	response    any
+	contentType string
+	// also lists other successful responses.
+	also       map[int]any
+	idempotent bool
+	// oauthErrors is set for operations that report some errors in the
+	// RFC 6749 format rather than as problem details.
+	oauthErrors bool
+}
+
+// oauthTokenForm documents the form body of the token endpoint. Which fields
+// are needed depends on grant_type.
+type oauthTokenForm struct {
+	GrantType    string `json:"grant_type" validate:"required,oneof=authorization_code refresh_token"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// oauthTokenActionForm documents the form body of the introspection and
+// revocation endpoints.
+type oauthTokenActionForm struct {
+	Token        string `json:"token" validate:"required"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+var openAPIOperations = map[string]operationDoc{
+	"GET /app/": {
+		id:          "getApp",
+		summary:     "Serve the web app and its static files",
+		tag:         "App",
+		status:      http.StatusOK,
+		response:    "",
+		contentType: "text/html",
+	},
+	"GET /admin/metrics": {
+		id:          "getMetrics",
+		summary:     "Show how many times the web app was visited",
+		tag:         "Admin",
+		auth:        authBearer,
+		role:        roleModerator,
+		status:      http.StatusOK,
+		response:    "",
+		contentType: "text/html",
+	},
+	"POST /admin/reset": {
+		id:          "reset",
+		summary:     "Delete every user and reset the metrics",
+		description: "Only available when PLATFORM is dev.",
+		tag:         "Admin",
+		auth:        authBearer,
+		role:        roleAdmin,
+		status:      http.StatusOK,
+		response:    "",
+		contentType: "text/plain",
+	},
+	"PUT /admin/users/{userID}/role": {
+		id:       "setUserRole",
+		summary:  "Change a user's role",
+		tag:      "Admin",
+		auth:     authBearer,
+		role:     roleAdmin,
+		request:  adminSetRoleRequest{},
+		status:   http.StatusOK,
+		response: User{},
+	},
+	"POST /admin/users/{userID}/suspend": {
+		id:      "suspendUser",
+		summary: "Suspend a user",
+		tag:     "Admin",
+		auth:    authBearer,
+		role:    roleModerator,
+		status:  http.StatusNoContent,
+	},
+	"POST /admin/users/{userID}/unsuspend": {
+		id:      "unsuspendUser",
+		summary: "Lift a user's suspension",
+		tag:     "Admin",
+		auth:    authBearer,
+		role:    roleModerator,
+		status:  http.StatusNoContent,
+	},
+	"POST /admin/users/{userID}/unlock": {
+		id:      "unlockUser",
+		summary: "Clear a user's failed login attempts",
+		tag:     "Admin",
+		auth:    authBearer,
+		role:    roleModerator,
+		status:  http.StatusNoContent,
+	},
+	"GET /api/healthz": {
+		id:          "healthz",
+		summary:     "Check that the server is up",
+		tag:         "Meta",
+		status:      http.StatusOK,
+		response:    "",
+		contentType: "text/plain",
+	},
+	"GET /api/openapi.json": {
+		id:          "getOpenAPI",
+		summary:     "Get this OpenAPI document",
+		tag:         "Meta",
+		status:      http.StatusOK,
+		response:    map[string]any{},
+		contentType: "application/json",
+	},
+	"GET /api/chirps": {
+		id:          "listChirps",
+		summary:     "List published chirps",
+		description: "Chirps by users the caller blocked or muted are left out.",
+		tag:         "Chirps",
+		auth:        authOptionalBearer,
+		scope:       scopes.ChirpsRead,
+		query:       chirpsQuery{},
+		status:      http.StatusOK,
+		response:    []Chirp{},
+	},
+	"GET /api/chirps/{chirpID}": {
+		id:       "getChirp",
+		summary:  "Get a published chirp",
+		tag:      "Chirps",
+		status:   http.StatusOK,
+		response: Chirp{},
+	},
+	"GET /api/chirps/scheduled": {
+		id:       "listScheduledChirps",
+		summary:  "List the caller's chirps that are not published yet",
+		tag:      "Chirps",
+		auth:     authBearer,
+		scope:    scopes.ChirpsRead,
+		status:   http.StatusOK,
+		response: []Chirp{},
+	},
+	"POST /api/chirps": {
+		id:         "createChirp",
+		summary:    "Post a chirp, or schedule one with publish_at",
+		tag:        "Chirps",
+		auth:       authBearer,
+		scope:      scopes.ChirpsWrite,
+		request:    addChirpRequest{},
+		status:     http.StatusCreated,
+		response:   Chirp{},
+		idempotent: true,
+	},
+	"PUT /api/chirps/{chirpID}": {
+		id:       "updateChirp",
+		summary:  "Edit one of the caller's chirps",
+		tag:      "Chirps",
+		auth:     authBearer,
+		scope:    scopes.ChirpsWrite,
+		request:  editChirpRequest{},
+		status:   http.StatusOK,
+		response: Chirp{},
+	},
+	"DELETE /api/chirps/{chirpID}": {
+		id:      "deleteChirp",
+		summary: "Delete one of the caller's chirps",
+		tag:     "Chirps",
+		auth:    authBearer,
+		scope:   scopes.ChirpsWrite,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/users": {
+		id:         "createUser",
+		summary:    "Sign up",
+		tag:        "Users",
+		request:    createUserRequest{},
+		status:     http.StatusCreated,
+		response:   User{},
+		idempotent: true,
+	},
+	"PUT /api/users": {
+		id:          "updateUser",
+		summary:     "Change the caller's email and password",
+		description: "A new email is pending until it is verified. Every session is signed out and the response carries new tokens for the caller.",
+		tag:         "Users",
+		auth:        authBearer,
+		scope:       scopes.ProfileWrite,
+		request:     updateCredentialsRequest{},
+		status:      http.StatusOK,
+		response:    User{},
+	},
+	"DELETE /api/users": {
+		id:          "deleteUser",
+		summary:     "Delete the caller's account",
+		description: "With a deletion grace period the account is purged later and can be restored until then, and the response says when.",
+		tag:         "Users",
+		auth:        authBearer,
+		request:     deleteUserRequest{},
+		status:      http.StatusNoContent,
+		also:        map[int]any{http.StatusAccepted: AccountDeletion{}},
+	},
+	"POST /api/users/restore": {
+		id:       "restoreUser",
+		summary:  "Restore an account that is pending deletion",
+		tag:      "Users",
+		request:  restoreUserRequest{},
+		status:   http.StatusOK,
+		response: User{},
+	},
+	"POST /api/login": {
+		id:          "login",
+		summary:     "Log in with email and password",
+		description: "Accounts with two-factor authentication get an MFA challenge to complete with loginMFA.",
+		tag:         "Auth",
+		request:     loginRequest{},
+		status:      http.StatusOK,
+		response:    oneOf{User{}, MFAChallenge{}},
+	},
+	"POST /api/login/mfa": {
+		id:       "loginMFA",
+		summary:  "Complete a login with a TOTP or recovery code",
+		tag:      "Auth",
+		request:  loginMFARequest{},
+		status:   http.StatusOK,
+		response: User{},
+	},
+	"POST /api/login/oidc": {
+		id:          "startOIDCLogin",
+		summary:     "Start a single sign-on login",
+		description: "Also sets a cookie that the callback requires, so the login can only be finished in the same browser.",
+		tag:         "Auth",
+		status:      http.StatusOK,
+		response:    OIDCAuthorization{},
+	},
+	"POST /api/login/oidc/callback": {
+		id:          "finishOIDCLogin",
+		summary:     "Finish a single sign-on login",
+		description: "Must be sent with the cookie set when the login started.",
+		tag:         "Auth",
+		request:     oidcCallbackRequest{},
+		status:      http.StatusOK,
+		response:    oneOf{User{}, MFAChallenge{}},
+	},
+	"POST /api/users/me/2fa": {
+		id:       "enrollTOTP",
+		summary:  "Start enrolling an authenticator app",
+		tag:      "Two-factor",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: TOTPEnrollment{},
+	},
+	"POST /api/users/me/2fa/confirm": {
+		id:          "confirmTOTP",
+		summary:     "Turn on two-factor login with a code from the authenticator",
+		description: "Every other session is logged out. The response has new tokens for the caller.",
+		tag:         "Two-factor",
+		auth:        authBearer,
+		request:     confirmTOTPRequest{},
+		status:      http.StatusOK,
+		response:    TOTPConfirmation{},
+	},
+	"DELETE /api/users/me/2fa": {
+		id:          "disableTOTP",
+		summary:     "Turn off two-factor login",
+		description: "Every session is logged out. The response has new tokens for the caller.",
+		tag:         "Two-factor",
+		auth:        authBearer,
+		request:     reauthenticationRequest{},
+		status:      http.StatusOK,
+		response:    User{},
+	},
+	"POST /api/users/me/2fa/recovery-codes": {
+		id:       "regenerateRecoveryCodes",
+		summary:  "Replace the caller's recovery codes",
+		tag:      "Two-factor",
+		auth:     authBearer,
+		request:  reauthenticationRequest{},
+		status:   http.StatusOK,
+		response: RecoveryCodes{},
+	},
+	"POST /api/password/forgot": {
+		id:          "forgotPassword",
+		summary:     "Email a password reset token",
+		description: "The response is the same whether or not the email is registered.",
+		tag:         "Auth",
+		request:     forgotPasswordRequest{},
+		status:      http.StatusAccepted,
+	},
+	"POST /api/password/reset": {
+		id:      "resetPassword",
+		summary: "Set a new password with a reset token",
+		tag:     "Auth",
+		request: resetPasswordRequest{},
+		status:  http.StatusNoContent,
+	},
+	"POST /api/email/verify": {
+		id:       "verifyEmail",
+		summary:  "Verify an email address with the emailed token",
+		tag:      "Users",
+		request:  verifyEmailRequest{},
+		status:   http.StatusOK,
+		response: User{},
+	},
+	"POST /api/email/verify/resend": {
+		id:      "resendEmailVerification",
+		summary: "Send a new email verification token",
+		tag:     "Users",
+		auth:    authBearer,
+		status:  http.StatusAccepted,
+	},
+	"POST /api/refresh": {
+		id:          "refresh",
+		summary:     "Get a new access token",
+		description: "The bearer token is the refresh token from login.",
+		tag:         "Auth",
+		auth:        authBearer,
+		status:      http.StatusOK,
+		response:    AccessToken{},
+	},
+	"POST /api/revoke": {
+		id:          "revoke",
+		summary:     "Revoke a refresh token",
+		description: "The bearer token is the refresh token to revoke.",
+		tag:         "Auth",
+		auth:        authBearer,
+		status:      http.StatusNoContent,
+	},
+	"GET /api/sessions": {
+		id:       "listSessions",
+		summary:  "List the caller's logged in devices",
+		tag:      "Sessions",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []Session{},
+	},
+	"DELETE /api/sessions/{sessionID}": {
+		id:      "revokeSession",
+		summary: "Log out one device",
+		tag:     "Sessions",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/sessions/revoke-all": {
+		id:      "revokeAllSessions",
+		summary: "Log out every device",
+		tag:     "Sessions",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/tokens": {
+		id:       "createPersonalAccessToken",
+		summary:  "Create a personal access token",
+		tag:      "Tokens",
+		auth:     authBearer,
+		request:  createPersonalAccessTokenRequest{},
+		status:   http.StatusCreated,
+		response: PersonalAccessToken{},
+	},
+	"GET /api/tokens": {
+		id:       "listPersonalAccessTokens",
+		summary:  "List the caller's personal access tokens",
+		tag:      "Tokens",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []PersonalAccessToken{},
+	},
+	"DELETE /api/tokens/{tokenID}": {
+		id:      "deletePersonalAccessToken",
+		summary: "Delete a personal access token",
+		tag:     "Tokens",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/oauth/clients": {
+		id:       "createOAuthClient",
+		summary:  "Register an OAuth client",
+		tag:      "OAuth",
+		auth:     authBearer,
+		request:  createOAuthClientRequest{},
+		status:   http.StatusCreated,
+		response: OAuthClient{},
+	},
+	"GET /api/oauth/clients": {
+		id:       "listOAuthClients",
+		summary:  "List the caller's OAuth clients",
+		tag:      "OAuth",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []OAuthClient{},
+	},
+	"DELETE /api/oauth/clients/{clientID}": {
+		id:      "deleteOAuthClient",
+		summary: "Delete an OAuth client and revoke its tokens",
+		tag:     "OAuth",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"GET /api/oauth/authorize": {
+		id:          "getOAuthConsent",
+		summary:     "Describe an authorization request for the consent screen",
+		tag:         "OAuth",
+		auth:        authBearer,
+		query:       oauthAuthorizationRequest{},
+		status:      http.StatusOK,
+		response:    OAuthConsent{},
+		oauthErrors: true,
+	},
+	"POST /api/oauth/authorize": {
+		id:          "authorizeOAuthClient",
+		summary:     "Approve or deny an authorization request",
+		description: "Once the client and redirect URI are valid, the outcome is reported through redirect_to.",
+		tag:         "OAuth",
+		auth:        authBearer,
+		request:     oauthAuthorizeRequest{},
+		status:      http.StatusOK,
+		response:    OAuthRedirect{},
+		oauthErrors: true,
+	},
+	"POST /oauth/token": {
+		id:          "oauthToken",
+		summary:     "Exchange an authorization code or refresh token",
+		tag:         "OAuth",
+		auth:        authOAuthClient,
+		request:     oauthTokenForm{},
+		form:        true,
+		status:      http.StatusOK,
+		response:    OAuthTokenResponse{},
+		oauthErrors: true,
+	},
+	"POST /oauth/introspect": {
+		id:          "oauthIntrospect",
+		summary:     "Describe an OAuth token",
+		tag:         "OAuth",
+		auth:        authOAuthClient,
+		request:     oauthTokenActionForm{},
+		form:        true,
+		status:      http.StatusOK,
+		response:    OAuthIntrospection{},
+		oauthErrors: true,
+	},
+	"POST /oauth/revoke": {
+		id:          "oauthRevoke",
+		summary:     "Revoke an OAuth token",
+		tag:         "OAuth",
+		auth:        authOAuthClient,
+		request:     oauthTokenActionForm{},
+		form:        true,
+		status:      http.StatusOK,
+		oauthErrors: true,
+	},
+	"POST /api/polka/webhooks": {
+		id:          "polkaWebhook",
+		summary:     "Receive a subscription event from Polka",
+		description: "Deliveries are identified by the Polka-Delivery-Id header, which is part of the signature.",
+		tag:         "Subscriptions",
+		auth:        authPolka,
+		request:     polkaWebhooksRequest{},
+		status:      http.StatusNoContent,
+	},
+	"GET /api/users/me/subscription": {
+		id:       "getSubscription",
+		summary:  "Get the caller's Chirpy Red subscription",
+		tag:      "Subscriptions",
+		auth:     authBearer,
+		scope:    scopes.ProfileRead,
+		status:   http.StatusOK,
+		response: Subscription{},
+	},
+	"POST /api/conversations": {
+		id:          "startConversation",
+		summary:     "Start a conversation with another user",
+		description: "If the two users already have a conversation it is returned with 200.",
+		tag:         "Messages",
+		auth:        authBearer,
+		scope:       scopes.MessagesWrite,
+		request:     startConversationRequest{},
+		status:      http.StatusCreated,
+		response:    Conversation{},
+		also:        map[int]any{http.StatusOK: Conversation{}},
+	},
+	"GET /api/conversations": {
+		id:       "listConversations",
+		summary:  "List the caller's conversations",
+		tag:      "Messages",
+		auth:     authBearer,
+		scope:    scopes.MessagesRead,
+		status:   http.StatusOK,
+		response: []Conversation{},
+	},
+	"GET /api/conversations/{conversationID}/messages": {
+		id:       "listMessages",
+		summary:  "List the messages in a conversation",
+		tag:      "Messages",
+		auth:     authBearer,
+		scope:    scopes.MessagesRead,
+		status:   http.StatusOK,
+		response: []Message{},
+	},
+	"POST /api/conversations/{conversationID}/messages": {
+		id:         "sendMessage",
+		summary:    "Send a message",
+		tag:        "Messages",
+		auth:       authBearer,
+		scope:      scopes.MessagesWrite,
+		request:    sendMessageRequest{},
+		status:     http.StatusCreated,
+		response:   Message{},
+		idempotent: true,
+	},
+	"POST /api/conversations/{conversationID}/read": {
+		id:      "markMessagesRead",
+		summary: "Mark the messages sent to the caller as read",
+		tag:     "Messages",
+		auth:    authBearer,
+		scope:   scopes.MessagesWrite,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/users/{userID}/block": {
+		id:      "blockUser",
+		summary: "Block a user",
+		tag:     "Blocks",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"DELETE /api/users/{userID}/block": {
+		id:      "unblockUser",
+		summary: "Unblock a user",
+		tag:     "Blocks",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"POST /api/users/{userID}/mute": {
+		id:      "muteUser",
+		summary: "Mute a user",
+		tag:     "Blocks",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"DELETE /api/users/{userID}/mute": {
+		id:      "unmuteUser",
+		summary: "Unmute a user",
+		tag:     "Blocks",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"GET /api/users/me/blocks": {
+		id:       "listBlocks",
+		summary:  "List the users the caller blocked",
+		tag:      "Blocks",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []RelatedUser{},
+	},
+	"GET /api/users/me/mutes": {
+		id:       "listMutes",
+		summary:  "List the users the caller muted",
+		tag:      "Blocks",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []RelatedUser{},
+	},
+	"POST /api/reports": {
+		id:          "createReport",
+		summary:     "Report a chirp or a user to the moderators",
+		description: "Exactly one of chirp_id and user_id is set.",
+		tag:         "Reports",
+		auth:        authBearer,
+		request:     createReportRequest{},
+		status:      http.StatusCreated,
+		response:    Report{},
+	},
+	"GET /api/notifications": {
+		id:       "listNotifications",
+		summary:  "List the caller's notifications",
+		tag:      "Notifications",
+		auth:     authBearer,
+		scope:    scopes.NotificationsRead,
+		status:   http.StatusOK,
+		response: []Notification{},
+	},
+	"POST /api/notifications/read": {
+		id:      "markNotificationsRead",
+		summary: "Mark the caller's notifications as read",
+		tag:     "Notifications",
+		auth:    authBearer,
+		scope:   scopes.NotificationsWrite,
+		status:  http.StatusNoContent,
+	},
+	"GET /admin/reports": {
+		id:       "listReports",
+		summary:  "List reports",
+		tag:      "Admin",
+		auth:     authBearer,
+		role:     roleModerator,
+		query:    reportsQuery{},
+		status:   http.StatusOK,
+		response: []Report{},
+	},
+	"GET /admin/reports/{reportID}": {
+		id:       "getReport",
+		summary:  "Get a report with the actions taken on it",
+		tag:      "Admin",
+		auth:     authBearer,
+		role:     roleModerator,
+		status:   http.StatusOK,
+		response: Report{},
+	},
+	"POST /admin/reports/{reportID}/resolve": {
+		id:       "resolveReport",
+		summary:  "Resolve a report, optionally taking moderation actions",
+		tag:      "Admin",
+		auth:     authBearer,
+		role:     roleModerator,
+		request:  adminResolveReportRequest{},
+		status:   http.StatusOK,
+		response: Report{},
+	},
+	"POST /api/webhooks": {
+		id:          "createWebhook",
+		summary:     "Subscribe a URL to events",
+		description: "The URL must use https and resolve to a public address. Receivers that redirect are not followed.",
+		tag:         "Webhooks",
+		auth:        authBearer,
+		request:     createWebhookRequest{},
+		status:      http.StatusCreated,
+		response:    Webhook{},
+	},
+	"GET /api/webhooks": {
+		id:       "listWebhooks",
+		summary:  "List the caller's webhooks",
+		tag:      "Webhooks",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []Webhook{},
+	},
+	"GET /api/webhooks/{webhookID}": {
+		id:       "getWebhook",
+		summary:  "Get a webhook",
+		tag:      "Webhooks",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: Webhook{},
+	},
+	"PUT /api/webhooks/{webhookID}": {
+		id:       "updateWebhook",
+		summary:  "Change a webhook",
+		tag:      "Webhooks",
+		auth:     authBearer,
+		request:  updateWebhookRequest{},
+		status:   http.StatusOK,
+		response: Webhook{},
+	},
+	"DELETE /api/webhooks/{webhookID}": {
+		id:      "deleteWebhook",
+		summary: "Delete a webhook",
+		tag:     "Webhooks",
+		auth:    authBearer,
+		status:  http.StatusNoContent,
+	},
+	"GET /api/webhooks/{webhookID}/deliveries": {
+		id:       "listWebhookDeliveries",
+		summary:  "List a webhook's recent deliveries",
+		tag:      "Webhooks",
+		auth:     authBearer,
+		status:   http.StatusOK,
+		response: []WebhookDelivery{},
+	},
+	"POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver": {
+		id:       "redeliverWebhook",
+		summary:  "Send a delivery again",
+		tag:      "Webhooks",
+		auth:     authBearer,
+		status:   http.StatusAccepted,
+		response: WebhookDelivery{},
+	},
+}
+
+type jsonSchema map[string]any
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]jsonSchema      `json:"schemas"`
+	Responses       map[string]openAPIResponse `json:"responses"`
+	SecuritySchemes map[string]jsonSchema      `json:"securitySchemes"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string     `json:"name"`
+	In          string     `json:"in"`
+	Description string     `json:"description,omitempty"`
+	Required    bool       `json:"required,omitempty"`
+	Schema      jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema jsonSchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+// openAPISpec is built once; it only depends on the code.
+var openAPISpec = sync.OnceValue(buildOpenAPISpec)
+
+func handlerOpenAPI(writer http.ResponseWriter, req *http.Request) {
+	writeJSONResponse(writer, http.StatusOK, openAPISpec())
+}
+
+var pathParameterPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+func buildOpenAPISpec() openAPIDocument {
+	schemas := &schemaBuilder{components: map[string]jsonSchema{}, names: map[componentKey]string{}}
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Chirpy API",
+			Version:     "1.0.0",
+			Description: "Errors are RFC 7807 problem details unless an operation says otherwise.",
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Responses: map[string]openAPIResponse{
+				"Problem": {
+					Description: "The request failed",
+					Content: map[string]openAPIMediaType{
+						problemContentType: {Schema: schemas.response(reflect.TypeFor[errorResponse]())},
+					},
+				},
+				"OAuthError": {
+					Description: "The request failed",
+					Content: map[string]openAPIMediaType{
+						problemContentType: {Schema: schemas.response(reflect.TypeFor[errorResponse]())},
+						"application/json": {Schema: schemas.response(reflect.TypeFor[oauth.Error]())},
+					},
+				},
+			},
+			SecuritySchemes: map[string]jsonSchema{
+				"bearerAuth": {
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "An access token from login. Personal access tokens and OAuth access tokens are accepted by operations that name a scope.",
+				},
+				"polkaKey": {
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "Polka-Signature",
+					"description": "An HMAC of the delivery made with a key shared with Polka.",
+				},
+				"oauthClient": {
+					"type":        "http",
+					"scheme":      "basic",
+					"description": "OAuth client credentials. They may be sent as client_id and client_secret in the form body instead, and public clients only send client_id.",
+				},
+			},
+		},
+	}
+	// Operations are visited in a fixed order so that component names do
+	// not depend on map iteration.
+	for _, pattern := range slices.Sorted(maps.Keys(openAPIOperations)) {
+		op := openAPIOperations[pattern]
+		method, path, _ := strings.Cut(pattern, " ")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = op.operation(path, schemas)
+	}
+	doc.Components.Schemas = schemas.components
+	return doc
+}
+
+func (op operationDoc) operation(path string, schemas *schemaBuilder) *openAPIOperation {
+	result := &openAPIOperation{
+		OperationID: op.id,
+		Summary:     op.summary,
+		Description: op.description,
+		Tags:        []string{op.tag},
+		Responses:   map[string]openAPIResponse{},
+	}
+	if op.scope != "" {
+		result.Description = strings.TrimSpace(result.Description + fmt.Sprintf(" Personal access tokens and OAuth tokens need the %s scope.", op.scope))
+	}
+	if op.role != "" {
+		result.Description = strings.TrimSpace(result.Description + fmt.Sprintf(" The caller needs the %s role.", op.role))
+	}
+	switch op.auth {
+	case authBearer:
+		result.Security = []map[string][]string{{"bearerAuth": {}}}
+	case authOptionalBearer:
+		result.Security = []map[string][]string{{}, {"bearerAuth": {}}}
+	case authPolka:
+		result.Security = []map[string][]string{{"polkaKey": {}}}
+	case authOAuthClient:
+		result.Security = []map[string][]string{{"oauthClient": {}}, {}}
+	}
+
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(path, -1) {
+		schema := jsonSchema{"type": "string"}
+		// OAuth client IDs are opaque; every other ID is a UUID.
+		if match[1] != "clientID" {
+			schema["format"] = "uuid"
+		}
+		result.Parameters = append(result.Parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+	if op.query != nil {
+		for _, field := range schemas.fields(reflect.TypeOf(op.query), true) {
+			result.Parameters = append(result.Parameters, openAPIParameter{Name: field.name, In: "query", Required: field.required, Schema: field.schema})
+		}
+	}
+	if op.idempotent {
+		result.Parameters = append(result.Parameters, openAPIParameter{
+			Name:        "Idempotency-Key",
+			In:          "header",
+			Description: "Retries with the same key replay the first response instead of repeating the request.",
+			Schema:      jsonSchema{"type": "string", "maxLength": maxIdempotencyKeyLength},
+		})
+	}
+
+	if op.request != nil {
+		contentType := "application/json"
+		if op.form {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		result.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content:  map[string]openAPIMediaType{contentType: {Schema: schemas.request(reflect.TypeOf(op.request))}},
+		}
+	}
+
+	result.Responses[strconv.Itoa(op.status)] = schemas.responseBody(op.status, op.response, op.contentType)
+	for status, body := range op.also {
+		result.Responses[strconv.Itoa(status)] = schemas.responseBody(status, body, "")
+	}
+	failure := "#/components/responses/Problem"
+	if op.oauthErrors {
+		failure = "#/components/responses/OAuthError"
+	}
+	result.Responses["default"] = openAPIResponse{Ref: failure}
+	return result
+}
+
+// schemaBuilder generates JSON Schemas from Go types, using the JSON names
+// of fields and the rules in their validate tags. Named structs become
+// components so each is described once.
+type schemaBuilder struct {
+	components map[string]jsonSchema
+	names      map[componentKey]string
+}
+
+// componentKey identifies a component. A type gets separate request and
+// response components because different fields are required in each.
+type componentKey struct {
+	t       reflect.Type
+	request bool
+}
+
+// schemaNames renames components whose Go names are ambiguous in the
+// document.
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeFor[oauth.Error](): "OAuthError",
+}
+
+// schemaField is a property of an object schema.
+type schemaField struct {
+	name     string
+	schema   jsonSchema
+	required bool
+}
+
+func (b *schemaBuilder) responseBody(status int, body any, contentType string) openAPIResponse {
+	response := openAPIResponse{Description: http.StatusText(status)}
+	if body == nil {
+		return response
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	var schema jsonSchema
+	switch body := body.(type) {
+	case oneOf:
+		var alternatives []jsonSchema
+		for _, alternative := range body {
+			alternatives = append(alternatives, b.response(reflect.TypeOf(alternative)))
+		}
+		schema = jsonSchema{"oneOf": alternatives}
+	default:
+		schema = b.response(reflect.TypeOf(body))
+	}
+	response.Content = map[string]openAPIMediaType{contentType: {Schema: schema}}
+	return response
+}
+
+func (b *schemaBuilder) request(t reflect.Type) jsonSchema {
+	return b.schema(t, true)
+}
+
+func (b *schemaBuilder) response(t reflect.Type) jsonSchema {
+	return b.schema(t, false)
+}
+
+// schema describes t. In requests only fields with the required rule are
+// required; in responses every field without omitempty is.
+func (b *schemaBuilder) schema(t reflect.Type, request bool) jsonSchema {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return jsonSchema{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[uuid.UUID]():
+		return jsonSchema{"type": "string", "format": "uuid"}
+	case reflect.TypeFor[json.RawMessage]():
+		return jsonSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := b.schema(t.Elem(), request)
+		if schemaType, ok := schema["type"].(string); ok {
+			schema["type"] = []string{schemaType, "null"}
+		}
+		return schema
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return jsonSchema{"type": "array", "items": b.schema(t.Elem(), request)}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": b.schema(t.Elem(), request)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t, request)
+		}
+		key := componentKey{t: t, request: request}
+		name, ok := b.names[key]
+		if !ok {
+			name, ok = schemaNames[t]
+			if !ok {
+				name = t.Name()
+			}
+			// The type was already described for the other direction.
+			if _, taken := b.components[name]; taken {
+				if request {
+					name += "Request"
+				} else {
+					name += "Response"
+				}
+			}
+			// Claim the name first so that recursive types terminate.
+			b.names[key] = name
+			b.components[name] = jsonSchema{}
+			b.components[name] = b.object(t, request)
+		}
+		return jsonSchema{"$ref": "#/components/schemas/" + name}
+	}
+	return jsonSchema{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type, request bool) jsonSchema {
+	properties := map[string]jsonSchema{}
+	required := []string{}
+	for _, field := range b.fields(t, request) {
+		properties[field.name] = field.schema
+		if field.required {
+			required = append(required, field.name)
+		}
+	}
+	schema := jsonSchema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fields lists the JSON properties of struct type t, including those of
+// embedded structs.
+func (b *schemaBuilder) fields(t reflect.Type, request bool) []schemaField {
+	var fields []schemaField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, b.fields(field.Type, request)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := b.schema(field.Type, request)
+		required := !request && !strings.Contains(options, "omitempty")
+		for rule := range strings.SplitSeq(field.Tag.Get("validate"), ",") {
+			rule, arg, _ := strings.Cut(rule, "=")
+			switch rule {
+			case "required":
+				required = true
+			case "min", "max":
+				limit, _ := strconv.Atoi(arg)
+				schema[limitKeyword(rule, field.Type)] = limit
+			case "email":
+				schema["format"] = "email"
+			case "uuid":
+				schema["format"] = "uuid"
+			case "oneof":
+				schema["enum"] = strings.Fields(arg)
+			}
+		}
+		fields = append(fields, schemaField{name: name, schema: schema, required: required})
+	}
+	return fields
+}
+
+// limitKeyword is the JSON Schema keyword for a min or max rule on a field
+// of type t.
+func limitKeyword(rule string, t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return rule + "Length"
+	case reflect.Slice:
+		return rule + "Items"
+	}
+	return rule + "imum"
+}
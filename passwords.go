@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/mailer"
+)
+
+const passwordResetTokenExpiration = time.Hour
+
+const (
+	defaultPasswordMinLength = 8
+	maxPasswordLength        = 256
+)
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" validate:"required"`
+}
+
+// handlerForgotPassword mails a reset token to the account's address. It
+// answers 202 whether or not the email is registered so that it cannot be
+// used to discover accounts, and does all of the work after answering so that
+// the response time does not tell them apart either.
+func (cfg *apiConfig) handlerForgotPassword(writer http.ResponseWriter, req *http.Request) {
+	var requestData forgotPasswordRequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	go cfg.sendPasswordReset(context.Background(), requestData.Email)
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset creates a reset token for the account with email, if
+// there is an active one, and mails it. Failures are only logged since the
+// request has already been answered.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting user from DB: %s", err)
+		}
+		return
+	}
+	if accountStatusError(user) != nil {
+		return
+	}
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error generating password reset token: %s", err)
+		return
+	}
+	if err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenExpiration),
+	}); err != nil {
+		log.Printf("Error saving password reset token: %s", err)
+		return
+	}
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Reset it here: %s/app/reset-password?token=%s\n\n"+
+			"The link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			cfg.publicURL, token, passwordResetTokenExpiration),
+	}
+	if err := cfg.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Error sending password reset email: %s", err)
+	}
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// handlerResetPassword sets a new password using a token from
+// handlerForgotPassword. The token can only be used once, and every session
+// and access token for the account is revoked so other devices have to log in
+// again.
+func (cfg *apiConfig) handlerResetPassword(writer http.ResponseWriter, req *http.Request) {
+	var requestData resetPasswordRequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	resetToken, err := qtx.UsePasswordResetToken(req.Context(), auth.HashToken(requestData.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Printf("Error using password reset token: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	user, err := qtx.GetUserByID(req.Context(), resetToken.UserID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	// Returning here rolls back the transaction, so the token can be used
+	// again with an acceptable password.
+	if err := cfg.passwordPolicy.Check(requestData.Password, user.Email); err != nil {
+		writeValidationError(writer, req, invalidField("password", errorDetail(err)))
+		return
+	}
+	hashedPassword, err := cfg.passwordHasher.Hash(requestData.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := qtx.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             resetToken.UserID,
+	}); err != nil {
+		log.Printf("Error updating password: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := qtx.DeletePasswordResetTokensForUser(req.Context(), resetToken.UserID); err != nil {
+		log.Printf("Error deleting password reset tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := revokeAllTokens(req.Context(), qtx, resetToken.UserID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// newMailer builds the mailer selected by MAILER. "smtp" sends through
+// SMTP_ADDR and "log" writes messages to MAIL_LOG_FILE, or stdout when that is
+// not set. Logged messages contain usable reset tokens, so MAILER may only be
+// left unset on the dev platform, where it defaults to "log". MAIL_FROM must
+// be an address, optionally with a display name.
+func newMailer(platform string) (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q - %w", from, err)
+	}
+	kind := os.Getenv("MAILER")
+	if kind == "" && platform == "dev" {
+		kind = "log"
+	}
+	switch kind {
+	case "smtp":
+		return &mailer.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "log":
+	case "":
+		return nil, errors.New("MAILER must be set to smtp or log")
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+	path := os.Getenv("MAIL_LOG_FILE")
+	if path == "" {
+		return &mailer.LogMailer{Writer: os.Stdout, From: from}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &mailer.LogMailer{Writer: file, From: from}, nil
+}
+
+// rehashPassword stores a hash with the current parameters after a login
+// verified the password against an outdated one. Failure only means the
+// rehash is tried again on the next login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPassword, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+	if err := cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userID,
+	}); err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
+
+// newPasswordHasher uses the default argon2id parameters, overridden by
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM. Changing them
+// causes existing hashes to be upgraded as users log in.
+func newPasswordHasher() (*auth.PasswordHasher, error) {
+	params := auth.DefaultArgon2Params
+	for _, setting := range []struct {
+		name  string
+		value *uint32
+	}{
+		{"ARGON2_MEMORY_KIB", &params.Memory},
+		{"ARGON2_ITERATIONS", &params.Iterations},
+	} {
+		if raw := os.Getenv(setting.name); raw != "" {
+			parsed, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || parsed == 0 {
+				return nil, fmt.Errorf("invalid %s %q", setting.name, raw)
+			}
+			*setting.value = uint32(parsed)
+		}
+	}
+	if raw := os.Getenv("ARGON2_PARALLELISM"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("invalid ARGON2_PARALLELISM %q", raw)
+		}
+		params.Parallelism = uint8(parsed)
+	}
+	return auth.NewPasswordHasher(params), nil
+}
+
+// newPasswordPolicy requires PASSWORD_MIN_LENGTH characters (default 8) and
+// rejects common passwords, plus any listed one per line in
+// BREACHED_PASSWORDS_FILE.
+func newPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength := defaultPasswordMinLength
+	if raw := os.Getenv("PASSWORD_MIN_LENGTH"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", raw)
+		}
+		minLength = parsed
+	}
+	policy := auth.NewPasswordPolicy(minLength, maxPasswordLength)
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if err := policy.AddBreached(file); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/subscription"
+)
+
+type Subscription struct {
+	Plan               string              `json:"plan"`
+	Status             string              `json:"status"`
+	CurrentPeriodStart time.Time           `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time           `json:"current_period_end"`
+	IsChirpyRed        bool                `json:"is_chirpy_red"`
+	History            []SubscriptionEvent `json:"history"`
+}
+type SubscriptionEvent struct {
+	CreatedAt        time.Time `json:"created_at"`
+	Event            string    `json:"event"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+const polkaSignatureTolerance = 5 * time.Minute
+const maxWebhookBodyBytes = 1 << 20
+const subscriptionExpiryInterval = 10 * time.Minute
+
+type polkaWebhooksRequest struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID      string    `json:"user_id"`
+		Plan        string    `json:"plan"`
+		PeriodStart time.Time `json:"period_start"`
+		PeriodEnd   time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+func (cfg *apiConfig) handlerPolkaWebhooks(writer http.ResponseWriter, req *http.Request) {
+	var requestData polkaWebhooksRequest
+	body, err := io.ReadAll(http.MaxBytesReader(writer, req.Body, maxWebhookBodyBytes))
+	if err != nil {
+		log.Printf("Error reading webhook body: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Error reading body")
+		return
+	}
+	deliveryID := req.Header.Get("Polka-Delivery-Id")
+	if deliveryID == "" {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Missing delivery ID")
+		return
+	}
+	if err := auth.VerifyWebhookSignature(req.Header.Get("Polka-Signature"), body, deliveryID, cfg.polkaKeys, polkaSignatureTolerance, time.Now()); err != nil {
+		log.Printf("Error verifying webhook signature: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid signature")
+		return
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		writeDecodeError(writer, req, err)
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	// The delivery is recorded in the same transaction as its effects, so a
+	// failed delivery can be retried while a duplicate is acknowledged.
+	inserted, err := qtx.CreateWebhookDelivery(req.Context(), database.CreateWebhookDeliveryParams{
+		ID:    deliveryID,
+		Event: requestData.Event,
+	})
+	if err != nil {
+		log.Printf("Error recording webhook delivery: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if inserted == 0 {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if subscription.IsPolkaEvent(requestData.Event) {
+		userID, err := uuid.Parse(requestData.Data.UserID)
+		if err != nil {
+			log.Printf("Error parsing user_id: %s", err)
+			writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+			return
+		}
+		event := subscription.Event{
+			Name:        requestData.Event,
+			Plan:        requestData.Data.Plan,
+			PeriodStart: requestData.Data.PeriodStart,
+			PeriodEnd:   requestData.Data.PeriodEnd,
+		}
+		if err := applySubscriptionEvent(req.Context(), qtx, userID, event, time.Now()); err != nil {
+			if err == sql.ErrNoRows {
+				writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+				return
+			}
+			log.Printf("Error applying subscription event: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// applySubscriptionEvent updates the user's subscription, records the event in
+// its history and keeps is_chirpy_red in sync with the new state.
+func applySubscriptionEvent(ctx context.Context, qtx *database.Queries, userID uuid.UUID, event subscription.Event, now time.Time) error {
+	user, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	var current *subscription.State
+	existing, err := qtx.GetSubscriptionByUser(ctx, userID)
+	switch {
+	case err == nil:
+		current = &subscription.State{
+			Plan:        existing.Plan,
+			Status:      existing.Status,
+			PeriodStart: existing.CurrentPeriodStart,
+			PeriodEnd:   existing.CurrentPeriodEnd,
+		}
+	case err != sql.ErrNoRows:
+		return err
+	case user.IsChirpyRed:
+		// Members upgraded before subscriptions were tracked normally got a
+		// row from a migration. Without one, trust the period Polka reports
+		// and otherwise give them a full period, so a downgrade does not
+		// end what they paid for.
+		current = &subscription.State{
+			Plan:        subscription.DefaultPlan,
+			Status:      subscription.StatusActive,
+			PeriodStart: user.CreatedAt,
+			PeriodEnd:   event.PeriodEnd,
+		}
+		if current.PeriodEnd.IsZero() {
+			current.PeriodEnd = now.Add(subscription.DefaultPeriod)
+		}
+	}
+	next, err := subscription.Apply(current, event, now)
+	if err == subscription.ErrNoSubscription {
+		log.Printf("Ignoring %s for user %s without a subscription", event.Name, userID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved, err := qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Plan:               next.Plan,
+		Status:             next.Status,
+		CurrentPeriodStart: next.PeriodStart,
+		CurrentPeriodEnd:   next.PeriodEnd,
+	})
+	if err != nil {
+		return err
+	}
+	if err := qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		SubscriptionID:   saved.ID,
+		Event:            event.Name,
+		Status:           saved.Status,
+		CurrentPeriodEnd: saved.CurrentPeriodEnd,
+	}); err != nil {
+		return err
+	}
+	return qtx.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{
+		IsChirpyRed: next.Entitled(now),
+		ID:          userID,
+	})
+}
+
+func (cfg *apiConfig) handlerSubscription(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	saved, err := cfg.db.GetSubscriptionByUser(req.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "No subscription")
+			return
+		}
+		log.Printf("Error getting subscription from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	events, err := cfg.db.GetSubscriptionEvents(req.Context(), saved.ID)
+	if err != nil {
+		log.Printf("Error getting subscription events from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := Subscription{
+		Plan:               saved.Plan,
+		Status:             saved.Status,
+		CurrentPeriodStart: saved.CurrentPeriodStart,
+		CurrentPeriodEnd:   saved.CurrentPeriodEnd,
+		IsChirpyRed:        user.IsChirpyRed,
+		History:            []SubscriptionEvent{},
+	}
+	for _, event := range events {
+		result.History = append(result.History, SubscriptionEvent{
+			CreatedAt:        event.CreatedAt,
+			Event:            event.Event,
+			Status:           event.Status,
+			CurrentPeriodEnd: event.CurrentPeriodEnd,
+		})
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// expireLapsedSubscriptions periodically ends Chirpy Red for subscriptions
+// whose period is over without a renewal.
+func (cfg *apiConfig) expireLapsedSubscriptions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		expired, err := cfg.expireSubscriptions(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("Error expiring subscriptions: %s", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("Expired %d subscriptions", expired)
+		}
+	}
+}
+
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context, now time.Time) (int, error) {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	expired, err := qtx.ExpireLapsedSubscriptions(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, saved := range expired {
+		if err := qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+			SubscriptionID:   saved.ID,
+			Event:            subscription.EventExpired,
+			Status:           saved.Status,
+			CurrentPeriodEnd: saved.CurrentPeriodEnd,
+		}); err != nil {
+			return 0, err
+		}
+		if err := qtx.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{IsChirpyRed: false, ID: saved.UserID}); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), tx.Commit()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error codes are part of the API. Clients branch on them, so they must not
+// change once published; detail messages may.
+const (
+	codeBadRequest           = "bad_request"
+	codeInvalidJSON          = "invalid_json"
+	codeValidationFailed     = "validation_failed"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeInsufficientScope    = "insufficient_scope"
+	codeAccountUnavailable   = "account_unavailable"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codePayloadTooLarge      = "payload_too_large"
+	codeRateLimited          = "rate_limited"
+	codeLoginLocked          = "login_locked"
+	codeInternalError        = "internal_error"
+	codeUpstreamError        = "upstream_error"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	// problemTypeBase prefixes the code to form each problem's type URI. It
+	// is relative, so it resolves against whichever host served the error.
+	problemTypeBase      = "/problems/"
+	internalErrorMessage = "Something went wrong on our side. Try again later."
+)
+
+// errorResponse is an RFC 7807 problem details object. Code is a stable,
+// machine-readable version of Type. Error repeats Detail for clients written
+// before problem details were introduced.
+type errorResponse struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []fieldError `json:"errors,omitempty"`
+	Error    string       `json:"error"`
+}
+
+// fieldError describes one invalid field of a request body. Field is the JSON
+// name of the field.
+type fieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// codeForStatus is the code of errors that do not have a more specific one.
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return codeValidationFailed
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusInternalServerError:
+		return codeInternalError
+	case http.StatusBadGateway:
+		return codeUpstreamError
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
+
+// writeProblem fills in the fields of problem that follow from its status and
+// code, and writes it.
+func writeProblem(w http.ResponseWriter, req *http.Request, problem errorResponse) {
+	if problem.Code == "" {
+		problem.Code = codeForStatus(problem.Status)
+	}
+	problem.Type = problemTypeBase + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = req.URL.Path
+	problem.Error = problem.Detail
+	data, err := json.Marshal(problem)
+	if err != nil {
+		log.Printf("Error marshaling JSON: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(data)
+}
+
+// writeErrorResponse writes a problem with the generic code for statusCode.
+func writeErrorResponse(w http.ResponseWriter, req *http.Request, statusCode int, detail string) {
+	writeProblem(w, req, errorResponse{Status: statusCode, Detail: detail})
+}
+
+// writeCodedErrorResponse writes a problem with a specific code.
+func writeCodedErrorResponse(w http.ResponseWriter, req *http.Request, statusCode int, code, detail string) {
+	writeProblem(w, req, errorResponse{Status: statusCode, Code: code, Detail: detail})
+}
+
+// writeValidationError reports a well-formed request with invalid fields.
+func writeValidationError(w http.ResponseWriter, req *http.Request, errs ...fieldError) {
+	detail := "The request has invalid fields"
+	if len(errs) == 1 {
+		detail = errs[0].Detail
+	}
+	writeProblem(w, req, errorResponse{
+		Status: http.StatusUnprocessableEntity,
+		Code:   codeValidationFailed,
+		Detail: detail,
+		Errors: errs,
+	})
+}
+
+// invalidField returns a fieldError with the generic "invalid" code.
+func invalidField(field, detail string) fieldError {
+	return fieldError{Field: field, Code: "invalid", Detail: detail}
+}
+
+// errorDetail turns a Go error, which is lowercase by convention, into a
+// detail message by capitalizing its first word. A first word that is a field
+// name, such as publish_at, is left as it is.
+func errorDetail(err error) string {
+	message := err.Error()
+	first, _, _ := strings.Cut(message, " ")
+	if strings.Contains(first, "_") {
+		return message
+	}
+	r, size := utf8.DecodeRuneInString(message)
+	return string(unicode.ToUpper(r)) + message[size:]
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/entitlements"
+	"github.com/panaiotuzunov/Chirpy/internal/ratelimit"
+)
+
+const rateLimitedMessage = "Too many requests. Try again later."
+
+// rateLimitPolicy is the rate limit of one route.
+type rateLimitPolicy struct {
+	// perIP limits every request by client IP, with or without an access
+	// token, so that one client cannot spread its requests over many
+	// accounts.
+	perIP ratelimit.Limit
+	// byUser also limits requests with a valid access token by user ID, at
+	// the requests per minute of the user's plan. Routes that take
+	// credentials leave it off, so that a token cannot change their limit.
+	byUser bool
+}
+
+var (
+	// signInRateLimit applies to routes that take credentials or tokens, on
+	// top of the login lockout.
+	signInRateLimit = rateLimitPolicy{perIP: ratelimit.PerMinute(10)}
+	// signUpRateLimit applies to routes that create accounts or send email.
+	signUpRateLimit = rateLimitPolicy{perIP: ratelimit.Limit{Requests: 20, Period: time.Hour, Burst: 5}}
+	// writeRateLimit applies to routes that create content. They all need
+	// an access token, so the limit per IP is set well above the largest
+	// plan and the plan is what limits a single user.
+	writeRateLimit = rateLimitPolicy{perIP: ratelimit.PerMinute(600), byUser: true}
+)
+
+// newTrustedProxies reads TRUSTED_PROXIES, a comma separated list of the
+// addresses and CIDR prefixes of reverse proxies whose X-Forwarded-For header
+// is believed.
+func newTrustedProxies() ([]netip.Prefix, error) {
+	return ratelimit.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+}
+
+// clientIP returns the address of the client, looking through trusted
+// proxies.
+func (cfg *apiConfig) clientIP(req *http.Request) string {
+	return ratelimit.ClientIP(req, cfg.trustedProxies)
+}
+
+// middlewareRateLimit limits calls to next per route and caller, and sets the
+// RateLimit-* headers on every response from whichever of the client's and
+// the user's limits is closer to running out. It goes inside
+// middlewareRequireScope so that scoped tokens count against their user.
+// Requests are let through if the store fails.
+func (cfg *apiConfig) middlewareRateLimit(policy rateLimitPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		result, err := cfg.rateLimiter.Take(r.Context(), r.Pattern+" ip:"+cfg.clientIP(r), policy.perIP, now)
+		if err != nil {
+			log.Printf("Error checking rate limit: %s", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if result.Allowed && policy.byUser {
+			if userID, plan, ok := cfg.rateLimitUser(r); ok {
+				userResult, err := cfg.rateLimiter.Take(r.Context(), r.Pattern+" user:"+userID.String(), ratelimit.PerMinute(plan.RequestsPerMinute), now)
+				if err != nil {
+					log.Printf("Error checking rate limit: %s", err)
+				} else if !userResult.Allowed || userResult.Remaining < result.Remaining {
+					result = userResult
+				}
+			}
+		}
+		ratelimit.SetHeaders(w.Header(), result)
+		if !result.Allowed {
+			writeErrorResponse(w, r, http.StatusTooManyRequests, rateLimitedMessage)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// rateLimitUser returns the user making an authenticated request and their
+// plan. The user is loaded while checking the token version, so this costs a
+// single query.
+func (cfg *apiConfig) rateLimitUser(req *http.Request) (uuid.UUID, entitlements.Entitlements, bool) {
+	tokenString, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return uuid.UUID{}, entitlements.Entitlements{}, false
+	}
+	userID, scoped := req.Context().Value(scopedTokenUserContextKey).(uuid.UUID)
+	if scoped {
+		user, err := cfg.db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			return uuid.UUID{}, entitlements.Entitlements{}, false
+		}
+		return user.ID, entitlements.For(user.IsChirpyRed), true
+	}
+	if isScopedToken(tokenString) {
+		return uuid.UUID{}, entitlements.Entitlements{}, false
+	}
+	isChirpyRed := false
+	userID, err = auth.ValidateJWT(tokenString, cfg.secret, func(userID uuid.UUID) (int32, error) {
+		user, err := cfg.db.GetUserByID(req.Context(), userID)
+		isChirpyRed = user.IsChirpyRed
+		return user.TokenVersion, err
+	})
+	if err != nil {
+		return uuid.UUID{}, entitlements.Entitlements{}, false
+	}
+	return userID, entitlements.For(isChirpyRed), true
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+type Report struct {
+	ID             uuid.UUID          `json:"id"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	ReporterID     uuid.UUID          `json:"reporter_id"`
+	ChirpID        *uuid.UUID         `json:"chirp_id"`
+	ReportedUserID uuid.UUID          `json:"reported_user_id"`
+	Reason         string             `json:"reason"`
+	Details        string             `json:"details"`
+	Status         string             `json:"status"`
+	ResolvedBy     *uuid.UUID         `json:"resolved_by"`
+	ResolvedAt     *time.Time         `json:"resolved_at"`
+	ResolutionNote string             `json:"resolution_note"`
+	Actions        []ModerationAction `json:"actions,omitempty"`
+}
+type ModerationAction struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	AdminID   *uuid.UUID `json:"admin_id"`
+	Action    string     `json:"action"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	UserID    *uuid.UUID `json:"user_id"`
+}
+
+const (
+	reportStatusActioned  = "actioned"
+	reportStatusDismissed = "dismissed"
+
+	moderationActionHideChirp     = "hide_chirp"
+	moderationActionSuspendUser   = "suspend_user"
+	moderationActionUnsuspendUser = "unsuspend_user"
+)
+
+const maxReportDetailsLength int = 1000
+
+var reportReasons = map[string]struct{}{
+	"spam":           {},
+	"harassment":     {},
+	"hate_speech":    {},
+	"violence":       {},
+	"self_harm":      {},
+	"misinformation": {},
+	"other":          {},
+}
+
+type createReportRequest struct {
+	ChirpID string `json:"chirp_id" validate:"uuid"`
+	UserID  string `json:"user_id" validate:"uuid"`
+	Reason  string `json:"reason" validate:"required"`
+	Details string `json:"details"`
+}
+
+func (cfg *apiConfig) handlerCreateReport(writer http.ResponseWriter, req *http.Request) {
+	var requestData createReportRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if _, ok := reportReasons[requestData.Reason]; !ok {
+		writeValidationError(writer, req, invalidField("reason", "Invalid reason"))
+		return
+	}
+	if len(requestData.Details) > maxReportDetailsLength {
+		writeValidationError(writer, req, invalidField("details", "Details are too long"))
+		return
+	}
+	if (requestData.ChirpID == "") == (requestData.UserID == "") {
+		writeValidationError(writer, req, invalidField("chirp_id", "Exactly one of chirp_id or user_id is required"))
+		return
+	}
+	params := database.CreateReportParams{
+		ReporterID: userID,
+		Reason:     requestData.Reason,
+		Details:    requestData.Details,
+	}
+	if requestData.ChirpID != "" {
+		chirpID, err := uuid.Parse(requestData.ChirpID)
+		if err != nil {
+			log.Printf("Error parsing chirp_id: %s", err)
+			writeValidationError(writer, req, invalidField("chirp_id", "Invalid chirp_id"))
+			return
+		}
+		chirp, err := cfg.db.GetChirpByID(req.Context(), chirpID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				writeErrorResponse(writer, req, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			log.Printf("Error getting chirp from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		params.ChirpID = uuid.NullUUID{UUID: chirp.ID, Valid: true}
+		params.ReportedUserID = chirp.UserID
+	} else {
+		reportedUserID, err := uuid.Parse(requestData.UserID)
+		if err != nil {
+			log.Printf("Error parsing user_id: %s", err)
+			writeValidationError(writer, req, invalidField("user_id", "Invalid user_id"))
+			return
+		}
+		if _, err := cfg.db.GetUserByID(req.Context(), reportedUserID); err != nil {
+			if err == sql.ErrNoRows {
+				writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+				return
+			}
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		params.ReportedUserID = reportedUserID
+	}
+	if params.ReportedUserID == userID {
+		writeValidationError(writer, req, invalidField("user_id", "Cannot report yourself"))
+		return
+	}
+	report, err := cfg.db.CreateReport(req.Context(), params)
+	if err != nil {
+		log.Printf("Error creating report: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusCreated, reportFromDB(report))
+}
+
+// reportsQuery is the query string of GET /admin/reports.
+type reportsQuery struct {
+	Status         string `json:"status"`
+	Reason         string `json:"reason"`
+	ReportedUserID string `json:"reported_user_id" validate:"uuid"`
+}
+
+func (cfg *apiConfig) handlerAdminReports(writer http.ResponseWriter, req *http.Request) {
+	var query reportsQuery
+	if !decodeQuery(writer, req, &query) {
+		return
+	}
+	var reportedUserID uuid.UUID
+	if query.ReportedUserID != "" {
+		reportedUserID = uuid.MustParse(query.ReportedUserID)
+	}
+	reports, err := cfg.db.GetReports(req.Context())
+	if err != nil {
+		log.Printf("Error getting reports from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	resultReports := []Report{}
+	for _, report := range reports {
+		if query.Status != "" && report.Status != query.Status {
+			continue
+		}
+		if query.Reason != "" && report.Reason != query.Reason {
+			continue
+		}
+		if reportedUserID != uuid.Nil && report.ReportedUserID != reportedUserID {
+			continue
+		}
+		resultReports = append(resultReports, reportFromDB(report))
+	}
+	writeJSONResponse(writer, http.StatusOK, resultReports)
+}
+
+func (cfg *apiConfig) handlerAdminGetReport(writer http.ResponseWriter, req *http.Request) {
+	reportID, err := uuid.Parse(req.PathValue("reportID"))
+	if err != nil {
+		log.Printf("Error parsing reportID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	report, err := cfg.db.GetReportByID(req.Context(), reportID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+			return
+		}
+		log.Printf("Error getting report from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	actions, err := cfg.db.GetModerationActionsByReport(req.Context(), uuid.NullUUID{UUID: report.ID, Valid: true})
+	if err != nil {
+		log.Printf("Error getting moderation actions from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := reportFromDB(report)
+	for _, action := range actions {
+		result.Actions = append(result.Actions, moderationActionFromDB(action))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+type adminResolveReportRequest struct {
+	Status  string   `json:"status" validate:"required,oneof=actioned dismissed"`
+	Note    string   `json:"note"`
+	Actions []string `json:"actions"`
+}
+
+func (cfg *apiConfig) handlerAdminResolveReport(writer http.ResponseWriter, req *http.Request) {
+	var requestData adminResolveReportRequest
+	adminID := userFromContext(req.Context()).ID
+	reportID, err := uuid.Parse(req.PathValue("reportID"))
+	if err != nil {
+		log.Printf("Error parsing reportID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if requestData.Status == reportStatusDismissed && len(requestData.Actions) > 0 {
+		writeValidationError(writer, req, invalidField("actions", "Dismissed reports cannot have actions"))
+		return
+	}
+	report, err := cfg.db.GetReportByID(req.Context(), reportID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+			return
+		}
+		log.Printf("Error getting report from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	for _, action := range requestData.Actions {
+		switch action {
+		case moderationActionHideChirp:
+			if !report.ChirpID.Valid {
+				writeValidationError(writer, req, invalidField("actions", "Report has no chirp to hide"))
+				return
+			}
+		case moderationActionSuspendUser:
+			reported, err := cfg.db.GetUserByID(req.Context(), report.ReportedUserID)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+					return
+				}
+				log.Printf("Error getting user from DB: %s", err)
+				writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+				return
+			}
+			if roleRanks[reported.Role] >= roleRanks[userFromContext(req.Context()).Role] {
+				writeErrorResponse(writer, req, http.StatusForbidden, "Forbidden")
+				return
+			}
+		default:
+			writeValidationError(writer, req, invalidField("actions", "Invalid action"))
+			return
+		}
+	}
+
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	report, err = qtx.ResolveReport(req.Context(), database.ResolveReportParams{
+		Status:         requestData.Status,
+		ResolvedBy:     uuid.NullUUID{UUID: adminID, Valid: true},
+		ResolutionNote: requestData.Note,
+		ID:             reportID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusConflict, "Report is already resolved")
+			return
+		}
+		log.Printf("Error resolving report: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := reportFromDB(report)
+	for _, action := range requestData.Actions {
+		params := database.CreateModerationActionParams{
+			AdminID:  uuid.NullUUID{UUID: adminID, Valid: true},
+			Action:   action,
+			ReportID: uuid.NullUUID{UUID: report.ID, Valid: true},
+		}
+		switch action {
+		case moderationActionHideChirp:
+			err = qtx.HideChirp(req.Context(), report.ChirpID.UUID)
+			params.ChirpID = report.ChirpID
+		case moderationActionSuspendUser:
+			err = qtx.SuspendUser(req.Context(), report.ReportedUserID)
+			if err == nil {
+				err = revokeAllTokens(req.Context(), qtx, report.ReportedUserID)
+			}
+			params.UserID = uuid.NullUUID{UUID: report.ReportedUserID, Valid: true}
+		}
+		if err != nil {
+			log.Printf("Error applying moderation action %s: %s", action, err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		moderationAction, err := qtx.CreateModerationAction(req.Context(), params)
+		if err != nil {
+			log.Printf("Error recording moderation action: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		result.Actions = append(result.Actions, moderationActionFromDB(moderationAction))
+	}
+	if _, err := qtx.CreateNotification(req.Context(), database.CreateNotificationParams{
+		UserID: report.ReporterID,
+		Kind:   notificationKindReportResolved,
+		Body:   fmt.Sprintf("Your report has been reviewed and %s.", report.Status),
+	}); err != nil {
+		log.Printf("Error creating notification: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+func reportFromDB(report database.Report) Report {
+	result := Report{
+		ID:             report.ID,
+		CreatedAt:      report.CreatedAt,
+		UpdatedAt:      report.UpdatedAt,
+		ReporterID:     report.ReporterID,
+		ReportedUserID: report.ReportedUserID,
+		Reason:         report.Reason,
+		Details:        report.Details,
+		Status:         report.Status,
+		ResolutionNote: report.ResolutionNote,
+	}
+	if report.ChirpID.Valid {
+		result.ChirpID = &report.ChirpID.UUID
+	}
+	if report.ResolvedBy.Valid {
+		result.ResolvedBy = &report.ResolvedBy.UUID
+	}
+	if report.ResolvedAt.Valid {
+		result.ResolvedAt = &report.ResolvedAt.Time
+	}
+	return result
+}
+
+func moderationActionFromDB(action database.ModerationAction) ModerationAction {
+	result := ModerationAction{
+		ID:        action.ID,
+		CreatedAt: action.CreatedAt,
+		Action:    action.Action,
+	}
+	if action.AdminID.Valid {
+		result.AdminID = &action.AdminID.UUID
+	}
+	if action.ChirpID.Valid {
+		result.ChirpID = &action.ChirpID.UUID
+	}
+	if action.UserID.Valid {
+		result.UserID = &action.UserID.UUID
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+// roleRanks orders roles so that a higher role satisfies any lower one.
+var roleRanks = map[string]int{
+	roleUser:      0,
+	roleModerator: 1,
+	roleAdmin:     2,
+}
+
+// middlewareRequireRole only calls next for active callers whose role is at
+// least role. The caller's user row is loaded on every request, so role
+// changes and suspensions take effect without waiting for access tokens to
+// expire.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := cfg.authenticatedUserID(r)
+		if err != nil {
+			log.Printf("Error authenticating request: %s", err)
+			writeErrorResponse(w, r, http.StatusUnauthorized, "Missing or invalid token")
+			return
+		}
+		user, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				writeErrorResponse(w, r, http.StatusUnauthorized, "Missing or invalid token")
+				return
+			}
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(w, r, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+		if err := accountStatusError(user); err != nil {
+			writeCodedErrorResponse(w, r, http.StatusForbidden, codeAccountUnavailable, errorDetail(err))
+			return
+		}
+		if roleRanks[user.Role] < roleRanks[role] {
+			writeErrorResponse(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// userFromContext returns the user stored by middlewareRequireRole.
+func userFromContext(ctx context.Context) database.User {
+	user, _ := ctx.Value(userContextKey).(database.User)
+	return user
+}
+
+type adminSetRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+func (cfg *apiConfig) handlerAdminSetRole(writer http.ResponseWriter, req *http.Request) {
+	var requestData adminSetRoleRequest
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing userID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if _, ok := roleRanks[requestData.Role]; !ok {
+		writeValidationError(writer, req, invalidField("role", "Invalid role"))
+		return
+	}
+	if userID == userFromContext(req.Context()).ID && requestData.Role != roleAdmin {
+		writeValidationError(writer, req, invalidField("role", "Cannot demote yourself"))
+		return
+	}
+	user, err := cfg.db.SetUserRole(req.Context(), database.SetUserRoleParams{Role: requestData.Role, ID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("Error setting user role: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, userFromDB(user))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/panaiotuzunov/Chirpy/internal/scopes"
+)
+
+// route is a pattern served by the API and its handler, with any middleware
+// already applied.
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// routes returns every route the server registers. Each one must also be
+// described in openAPIOperations.
+func (cfg *apiConfig) routes() []route {
+	return []route{
+		{"GET /app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir("./"))))},
+		{"GET /admin/metrics", cfg.middlewareRequireRole(roleModerator, cfg.ReturnMetrics)},
+		{"POST /admin/reset", cfg.middlewareRequireRole(roleAdmin, cfg.Reset)},
+		{"PUT /admin/users/{userID}/role", cfg.middlewareRequireRole(roleAdmin, cfg.handlerAdminSetRole)},
+		{"POST /admin/users/{userID}/suspend", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminSuspendUser)},
+		{"POST /admin/users/{userID}/unsuspend", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminUnsuspendUser)},
+		{"POST /admin/users/{userID}/unlock", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminUnlockUser)},
+		{"GET /api/healthz", http.HandlerFunc(handlerHealthz)},
+		{"GET /api/openapi.json", http.HandlerFunc(handlerOpenAPI)},
+		{"GET /api/chirps", cfg.middlewareRequireScope(scopes.ChirpsRead, cfg.handlerChirps)},
+		{"GET /api/chirps/{chirpID}", http.HandlerFunc(cfg.handlerGetChirp)},
+		{"GET /api/chirps/scheduled", cfg.middlewareRequireScope(scopes.ChirpsRead, cfg.handlerScheduledChirps)},
+		{"POST /api/chirps", cfg.middlewareRequireScope(scopes.ChirpsWrite, cfg.middlewareRateLimit(writeRateLimit, cfg.middlewareIdempotency(cfg.handlerAddChirp)))},
+		{"PUT /api/chirps/{chirpID}", cfg.middlewareRequireScope(scopes.ChirpsWrite, cfg.handlerEditChirp)},
+		{"DELETE /api/chirps/{chirpID}", cfg.middlewareRequireScope(scopes.ChirpsWrite, cfg.handlerDeleteChirp)},
+		{"POST /api/users", cfg.middlewareRateLimit(signUpRateLimit, cfg.middlewareIdempotency(cfg.handlerCreateUser))},
+		{"PUT /api/users", cfg.middlewareRequireScope(scopes.ProfileWrite, cfg.handlerUpdateCredentials)},
+		{"DELETE /api/users", http.HandlerFunc(cfg.handlerDeleteUser)},
+		{"POST /api/users/restore", http.HandlerFunc(cfg.handlerRestoreUser)},
+		{"POST /api/login", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerLogin)},
+		{"POST /api/login/mfa", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerLoginMFA)},
+		{"POST /api/login/oidc", http.HandlerFunc(cfg.handlerOIDCLogin)},
+		{"POST /api/login/oidc/callback", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerOIDCCallback)},
+		{"POST /api/users/me/2fa", http.HandlerFunc(cfg.handlerEnrollTOTP)},
+		{"POST /api/users/me/2fa/confirm", http.HandlerFunc(cfg.handlerConfirmTOTP)},
+		{"DELETE /api/users/me/2fa", http.HandlerFunc(cfg.handlerDisableTOTP)},
+		{"POST /api/users/me/2fa/recovery-codes", http.HandlerFunc(cfg.handlerRegenerateRecoveryCodes)},
+		{"POST /api/password/forgot", cfg.middlewareRateLimit(signUpRateLimit, cfg.handlerForgotPassword)},
+		{"POST /api/password/reset", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerResetPassword)},
+		{"POST /api/email/verify", http.HandlerFunc(cfg.handlerVerifyEmail)},
+		{"POST /api/email/verify/resend", cfg.middlewareRateLimit(signUpRateLimit, cfg.handlerResendEmailVerification)},
+		{"POST /api/refresh", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerRefresh)},
+		{"POST /api/revoke", http.HandlerFunc(cfg.handlerRevoke)},
+		{"GET /api/sessions", http.HandlerFunc(cfg.handlerSessions)},
+		{"DELETE /api/sessions/{sessionID}", http.HandlerFunc(cfg.handlerRevokeSession)},
+		{"POST /api/sessions/revoke-all", http.HandlerFunc(cfg.handlerRevokeAllSessions)},
+		{"POST /api/tokens", http.HandlerFunc(cfg.handlerCreatePersonalAccessToken)},
+		{"GET /api/tokens", http.HandlerFunc(cfg.handlerPersonalAccessTokens)},
+		{"DELETE /api/tokens/{tokenID}", http.HandlerFunc(cfg.handlerDeletePersonalAccessToken)},
+		{"POST /api/oauth/clients", http.HandlerFunc(cfg.handlerCreateOAuthClient)},
+		{"GET /api/oauth/clients", http.HandlerFunc(cfg.handlerOAuthClients)},
+		{"DELETE /api/oauth/clients/{clientID}", http.HandlerFunc(cfg.handlerDeleteOAuthClient)},
+		{"GET /api/oauth/authorize", http.HandlerFunc(cfg.handlerOAuthConsent)},
+		{"POST /api/oauth/authorize", http.HandlerFunc(cfg.handlerOAuthAuthorize)},
+		{"POST /oauth/token", cfg.middlewareRateLimit(signInRateLimit, cfg.handlerOAuthToken)},
+		{"POST /oauth/introspect", http.HandlerFunc(cfg.handlerOAuthIntrospect)},
+		{"POST /oauth/revoke", http.HandlerFunc(cfg.handlerOAuthRevoke)},
+		{"POST /api/polka/webhooks", http.HandlerFunc(cfg.handlerPolkaWebhooks)},
+		{"GET /api/users/me/subscription", cfg.middlewareRequireScope(scopes.ProfileRead, cfg.handlerSubscription)},
+		{"POST /api/conversations", cfg.middlewareRequireScope(scopes.MessagesWrite, cfg.handlerStartConversation)},
+		{"GET /api/conversations", cfg.middlewareRequireScope(scopes.MessagesRead, cfg.handlerConversations)},
+		{"GET /api/conversations/{conversationID}/messages", cfg.middlewareRequireScope(scopes.MessagesRead, cfg.handlerMessages)},
+		{"POST /api/conversations/{conversationID}/messages", cfg.middlewareRequireScope(scopes.MessagesWrite, cfg.middlewareRateLimit(writeRateLimit, cfg.middlewareIdempotency(cfg.handlerSendMessage)))},
+		{"POST /api/conversations/{conversationID}/read", cfg.middlewareRequireScope(scopes.MessagesWrite, cfg.handlerMarkMessagesRead)},
+		{"POST /api/users/{userID}/block", http.HandlerFunc(cfg.handlerBlockUser)},
+		{"DELETE /api/users/{userID}/block", http.HandlerFunc(cfg.handlerUnblockUser)},
+		{"POST /api/users/{userID}/mute", http.HandlerFunc(cfg.handlerMuteUser)},
+		{"DELETE /api/users/{userID}/mute", http.HandlerFunc(cfg.handlerUnmuteUser)},
+		{"GET /api/users/me/blocks", http.HandlerFunc(cfg.handlerBlocks)},
+		{"GET /api/users/me/mutes", http.HandlerFunc(cfg.handlerMutes)},
+		{"POST /api/reports", cfg.middlewareRateLimit(writeRateLimit, cfg.handlerCreateReport)},
+		{"GET /api/notifications", cfg.middlewareRequireScope(scopes.NotificationsRead, cfg.handlerNotifications)},
+		{"POST /api/notifications/read", cfg.middlewareRequireScope(scopes.NotificationsWrite, cfg.handlerMarkNotificationsRead)},
+		{"GET /admin/reports", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminReports)},
+		{"GET /admin/reports/{reportID}", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminGetReport)},
+		{"POST /admin/reports/{reportID}/resolve", cfg.middlewareRequireRole(roleModerator, cfg.handlerAdminResolveReport)},
+		{"POST /api/webhooks", http.HandlerFunc(cfg.handlerCreateWebhook)},
+		{"GET /api/webhooks", http.HandlerFunc(cfg.handlerWebhooks)},
+		{"GET /api/webhooks/{webhookID}", http.HandlerFunc(cfg.handlerGetWebhook)},
+		{"PUT /api/webhooks/{webhookID}", http.HandlerFunc(cfg.handlerUpdateWebhook)},
+		{"DELETE /api/webhooks/{webhookID}", http.HandlerFunc(cfg.handlerDeleteWebhook)},
+		{"GET /api/webhooks/{webhookID}/deliveries", http.HandlerFunc(cfg.handlerWebhookDeliveries)},
+		{"POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", http.HandlerFunc(cfg.handlerRedeliverWebhook)},
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+)
+
+// Session is a login on one device, backed by its refresh token. The token
+// itself is never returned.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+func sessionFromDB(token database.RefreshToken) Session {
+	session := Session{
+		ID:        token.ID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+		UserAgent: token.UserAgent,
+		IPAddress: token.IpAddress,
+	}
+	if token.LastUsedAt.Valid {
+		session.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return session
+}
+
+func (cfg *apiConfig) handlerSessions(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	tokens, err := cfg.db.GetActiveSessionsForUser(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting sessions from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []Session{}
+	for _, token := range tokens {
+		result = append(result, sessionFromDB(token))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// handlerRevokeSession logs one device out by revoking its refresh token.
+// Access tokens already issued to it stay valid until they expire.
+func (cfg *apiConfig) handlerRevokeSession(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		log.Printf("Error parsing sessionID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	revoked, err := cfg.db.RevokeSession(req.Context(), database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if revoked == 0 {
+		writeErrorResponse(writer, req, http.StatusNotFound, "Session not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeAllSessions logs the user out everywhere, including the device
+// making the request. Bumping the token version invalidates every access token
+// issued so far.
+func (cfg *apiConfig) handlerRevokeAllSessions(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	if err := revokeAllTokens(req.Context(), cfg.db.WithTx(tx), userID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllTokens revokes every refresh token of the user and bumps their
+// token version, which invalidates every access token issued so far.
+func revokeAllTokens(ctx context.Context, qtx *database.Queries, userID uuid.UUID) error {
+	if err := qtx.RevokeRefreshTokensForUser(ctx, userID); err != nil {
+		return err
+	}
+	return qtx.IncrementUserTokenVersion(ctx, userID)
+}
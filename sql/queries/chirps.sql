@@ -1,27 +1,53 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
 -- name: GetChirps :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE hidden_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
+ORDER BY COALESCE(publish_at, created_at) ASC;
 
 -- name: GetChirpsByAuthor :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE user_id = $1 AND hidden_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
+ORDER BY COALESCE(publish_at, created_at) ASC;
+
+-- name: GetScheduledChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND publish_at > NOW()
+ORDER BY publish_at ASC;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: AnnounceDueScheduledChirps :many
+UPDATE chirps
+SET announced_at = NOW()
+WHERE publish_at <= NOW() AND announced_at IS NULL AND hidden_at IS NULL
+RETURNING *;
@@ -0,0 +1,28 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, user_one_id, user_two_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2
+)
+RETURNING *;
+
+-- name: GetConversationByID :one
+SELECT * FROM conversations
+WHERE id = $1;
+
+-- name: GetConversationByParticipants :one
+SELECT * FROM conversations
+WHERE user_one_id = $1 AND user_two_id = $2;
+
+-- name: GetConversationsForUser :many
+SELECT * FROM conversations
+WHERE user_one_id = $1 OR user_two_id = $1
+ORDER BY updated_at DESC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
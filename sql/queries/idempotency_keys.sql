@@ -0,0 +1,50 @@
+-- name: ClaimIdempotencyKey :execrows
+INSERT INTO idempotency_keys (owner, idempotency_key, route, request_hash, created_at, expires_at, locked_until)
+VALUES (
+    sqlc.arg(owner),
+    sqlc.arg(idempotency_key),
+    sqlc.arg(route),
+    sqlc.arg(request_hash),
+    NOW(),
+    sqlc.arg(expires_at),
+    sqlc.arg(locked_until)
+)
+ON CONFLICT (owner, idempotency_key, route) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at,
+    locked_until = EXCLUDED.locked_until,
+    status_code = NULL,
+    content_type = NULL,
+    response_body = NULL
+WHERE idempotency_keys.expires_at < NOW()
+    OR (
+        idempotency_keys.status_code IS NULL
+        AND idempotency_keys.locked_until < NOW()
+        AND idempotency_keys.request_hash = EXCLUDED.request_hash
+    );
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE owner = $1 AND idempotency_key = $2 AND route = $3;
+
+-- name: SaveIdempotentResponse :exec
+UPDATE idempotency_keys
+SET status_code = sqlc.arg(status_code),
+    content_type = sqlc.arg(content_type),
+    response_body = sqlc.arg(response_body)
+WHERE owner = sqlc.arg(owner) AND idempotency_key = sqlc.arg(idempotency_key) AND route = sqlc.arg(route)
+    AND status_code IS NULL
+    AND request_hash = sqlc.arg(request_hash)
+    AND locked_until = sqlc.arg(locked_until);
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE owner = $1 AND idempotency_key = $2 AND route = $3
+    AND status_code IS NULL
+    AND request_hash = $4
+    AND locked_until = $5;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < NOW();
@@ -0,0 +1,31 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (key, failures, last_failure_at)
+VALUES (
+    sqlc.arg(key),
+    1,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failure_at < sqlc.arg(window_start)::timestamp THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET locked_until = $1
+WHERE key = $2;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
@@ -0,0 +1,25 @@
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, updated_at, conversation_id, sender_id, body, read_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    NULL
+)
+RETURNING *;
+
+-- name: GetMessagesByConversation :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at ASC;
+
+-- name: MarkMessagesRead :exec
+UPDATE messages
+SET read_at = NOW(),
+    updated_at = NOW()
+WHERE conversation_id = $1
+  AND sender_id != $2
+  AND read_at IS NULL;
@@ -0,0 +1,17 @@
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, created_at, admin_id, action, report_id, chirp_id, user_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetModerationActionsByReport :many
+SELECT * FROM moderation_actions
+WHERE report_id = $1
+ORDER BY created_at ASC;
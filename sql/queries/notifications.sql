@@ -0,0 +1,21 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, user_id, kind, body, read_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    NULL
+)
+RETURNING *;
+
+-- name: GetNotificationsForUser :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
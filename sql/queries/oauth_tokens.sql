@@ -0,0 +1,27 @@
+-- name: CreateOAuthToken :exec
+INSERT INTO oauth_tokens (token_hash, created_at, grant_id, token_type, client_id, user_id, scopes, expires_at, revoked_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NULL
+);
+
+-- name: GetOAuthToken :one
+SELECT * FROM oauth_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeOAuthToken :execrows
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE grant_id = $1 AND revoked_at IS NULL;
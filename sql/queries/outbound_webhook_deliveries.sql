@@ -0,0 +1,54 @@
+-- name: CreateOutboundWebhookDelivery :one
+INSERT INTO outbound_webhook_deliveries (id, created_at, updated_at, webhook_id, event, payload, status, attempts, next_attempt_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    'pending',
+    0,
+    NOW()
+)
+RETURNING *;
+
+-- name: ClaimDueOutboundWebhookDeliveries :many
+UPDATE outbound_webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)::timestamp,
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM outbound_webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT sqlc.arg(batch_size)::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordOutboundWebhookAttempt :one
+UPDATE outbound_webhook_deliveries
+SET status = $1,
+    attempts = attempts + 1,
+    next_attempt_at = $2,
+    last_status_code = $3,
+    last_error = $4,
+    delivered_at = $5,
+    updated_at = NOW()
+WHERE id = $6
+RETURNING *;
+
+-- name: GetOutboundWebhookDeliveries :many
+SELECT * FROM outbound_webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RetryOutboundWebhookDelivery :one
+UPDATE outbound_webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1 AND webhook_id = $2
+RETURNING *;
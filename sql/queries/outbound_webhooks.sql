@@ -0,0 +1,42 @@
+-- name: CreateOutboundWebhook :one
+INSERT INTO outbound_webhooks (id, created_at, updated_at, user_id, url, secret, events, scope, active)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    true
+)
+RETURNING *;
+
+-- name: GetOutboundWebhookByID :one
+SELECT * FROM outbound_webhooks
+WHERE id = $1;
+
+-- name: GetOutboundWebhooksByUser :many
+SELECT * FROM outbound_webhooks
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetOutboundWebhooksForEvent :many
+SELECT * FROM outbound_webhooks
+WHERE active
+  AND sqlc.arg(event)::text = ANY(events)
+  AND (user_id = sqlc.arg(owner_id) OR scope = 'global');
+
+-- name: UpdateOutboundWebhook :one
+UPDATE outbound_webhooks
+SET url = $1,
+    events = $2,
+    active = $3,
+    updated_at = NOW()
+WHERE id = $4
+RETURNING *;
+
+-- name: DeleteOutboundWebhook :exec
+DELETE FROM outbound_webhooks
+WHERE id = $1;
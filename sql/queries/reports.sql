@@ -0,0 +1,32 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, reporter_id, chirp_id, reported_user_id, reason, details, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    'open'
+)
+RETURNING *;
+
+-- name: GetReports :many
+SELECT * FROM reports
+ORDER BY created_at ASC;
+
+-- name: GetReportByID :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = $1,
+    resolved_by = $2,
+    resolved_at = NOW(),
+    resolution_note = $3,
+    updated_at = NOW()
+WHERE id = $4 AND status = 'open'
+RETURNING *;
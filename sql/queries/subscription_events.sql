@@ -0,0 +1,15 @@
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, created_at, subscription_id, event, status, current_period_end)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: GetSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE subscription_id = $1
+ORDER BY created_at ASC;
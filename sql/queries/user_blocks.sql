@@ -0,0 +1,34 @@
+-- name: CreateBlock :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlocksByBlocker :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $1 AND blocked_id = $2)
+       OR (blocker_id = $2 AND blocked_id = $1)
+);
+
+-- name: GetHiddenAuthorIDs :many
+SELECT blocked_id FROM user_blocks
+WHERE blocker_id = $1
+UNION
+SELECT blocker_id FROM user_blocks
+WHERE blocked_id = $1
+UNION
+SELECT muted_id FROM user_mutes
+WHERE muter_id = $1;
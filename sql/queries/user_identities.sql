@@ -0,0 +1,21 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (id, created_at, user_id, issuer, subject, email, last_login_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+);
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW(),
+    email = $2
+WHERE id = $1;
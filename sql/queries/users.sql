@@ -24,9 +24,116 @@ SET updated_at = NOW(),
 WHERE id = $3
 RETURNING *;
 
--- name: UpgradeUserToChirpyRed :one
+-- name: SetUserChirpyRed :exec
 UPDATE users
-SET is_chirpy_red = true,
+SET is_chirpy_red = $1,
     updated_at = NOW()
-WHERE id = $1
-RETURNING *;
\ No newline at end of file
+WHERE id = $2;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: SetUserRoleByEmail :one
+UPDATE users
+SET role = $1,
+    updated_at = NOW()
+WHERE email = $2
+RETURNING *;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkUserDeleted :exec
+UPDATE users
+SET deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: RestoreUser :exec
+UPDATE users
+SET deleted_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: SetPendingEmail :exec
+UPDATE users
+SET pending_email = $1,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: VerifyEmail :one
+UPDATE users
+SET email = $1,
+    email_verified_at = NOW(),
+    pending_email = NULLIF(pending_email, $1),
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $1,
+    totp_enabled_at = NULL,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_step = $1,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL,
+    totp_enabled_at = NULL,
+    totp_last_step = 0,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1;
+
+-- name: GetUserTokenVersion :one
+SELECT token_version FROM users
+WHERE id = $1;
+
+-- name: IncrementUserTokenVersion :exec
+UPDATE users
+SET token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1;
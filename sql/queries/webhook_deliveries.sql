@@ -0,0 +1,8 @@
+-- name: CreateWebhookDelivery :execrows
+INSERT INTO webhook_deliveries (id, received_at, event)
+VALUES (
+    $1,
+    NOW(),
+    $2
+)
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_one_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_two_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (user_one_id, user_two_id),
+    CHECK (user_one_id < user_two_id)
+);
+
+-- +goose Down
+DROP TABLE conversations;
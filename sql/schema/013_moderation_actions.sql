@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    admin_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('hide_chirp', 'suspend_user')),
+    report_id UUID REFERENCES reports(id) ON DELETE SET NULL,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
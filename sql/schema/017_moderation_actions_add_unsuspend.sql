@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check CHECK (action IN ('hide_chirp', 'suspend_user', 'unsuspend_user'));
+
+-- +goose Down
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check CHECK (action IN ('hide_chirp', 'suspend_user'));
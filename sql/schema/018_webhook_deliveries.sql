@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL,
+    event TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
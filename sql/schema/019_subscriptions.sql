@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'refunded', 'expired')),
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL
+);
+
+-- Members upgraded before subscriptions were tracked get a subscription with
+-- a full period from now, so a later downgrade keeps them on Chirpy Red until
+-- it ends.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), users.id, 'chirpy_red', 'active', NOW(), NOW() + INTERVAL '30 days'
+FROM users
+WHERE users.is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE subscription_events;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE outbound_webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('user', 'global')),
+    active BOOL NOT NULL
+);
+
+ALTER TABLE chirps
+ADD COLUMN announced_at TIMESTAMP;
+
+-- Scheduled chirps that are already published were announced when they were
+-- created or never will be; either way they must not be announced now.
+UPDATE chirps
+SET announced_at = publish_at
+WHERE publish_at <= NOW();
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN announced_at;
+
+DROP TABLE outbound_webhooks;
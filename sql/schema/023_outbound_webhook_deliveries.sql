@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE outbound_webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES outbound_webhooks(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INT NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INT,
+    last_error TEXT NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX outbound_webhook_deliveries_pending_idx
+ON outbound_webhook_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE outbound_webhook_deliveries;
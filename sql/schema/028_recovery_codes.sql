@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE recovery_codes (
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE recovery_codes;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE oauth_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    grant_id UUID NOT NULL,
+    token_type TEXT NOT NULL CHECK (token_type IN ('access', 'refresh')),
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX oauth_tokens_grant_id_idx ON oauth_tokens (grant_id);
+
+-- +goose Down
+DROP TABLE oauth_tokens;
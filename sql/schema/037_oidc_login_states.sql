@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    browser_hash TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- A claim whose request has not finished by locked_until is treated as
+-- abandoned, and a retry with the same request can take it over.
+CREATE TABLE idempotency_keys (
+    owner TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    route TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    status_code INT,
+    content_type TEXT,
+    response_body BYTEA,
+    locked_until TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner, idempotency_key, route)
+);
+
+-- +goose Down
+DROP TABLE idempotency_keys;
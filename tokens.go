@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/oauth"
+	"github.com/panaiotuzunov/Chirpy/internal/scopes"
+)
+
+const scopedTokenUserContextKey contextKey = "scoped_token_user"
+
+var (
+	errScopedTokenNotAllowed      = errors.New("personal access tokens and OAuth tokens cannot be used for this endpoint")
+	errPersonalAccessTokenExpired = errors.New("personal access token has expired")
+)
+
+// PersonalAccessToken is a long-lived API token. Token is only set in the
+// response that creates it.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+type createPersonalAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(writer http.ResponseWriter, req *http.Request) {
+	var requestData createPersonalAccessTokenRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	if _, ok := cfg.requireActiveAccount(writer, req, userID); !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	tokenScopes, err := scopes.Normalize(requestData.Scopes)
+	if err != nil {
+		writeValidationError(writer, req, invalidField("scopes", errorDetail(err)))
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if requestData.ExpiresAt != nil {
+		if !requestData.ExpiresAt.After(time.Now()) {
+			writeValidationError(writer, req, invalidField("expires_at", "expires_at must be in the future"))
+			return
+		}
+		expiresAt = sql.NullTime{Time: requestData.ExpiresAt.UTC(), Valid: true}
+	}
+	tokenString, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error generating personal access token: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	token, err := cfg.db.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      requestData.Name,
+		TokenHash: auth.HashToken(tokenString),
+		Scopes:    tokenScopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error creating personal access token: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := personalAccessTokenFromDB(token)
+	result.Token = tokenString
+	writeJSONResponse(writer, http.StatusCreated, result)
+}
+
+func (cfg *apiConfig) handlerPersonalAccessTokens(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	tokens, err := cfg.db.GetPersonalAccessTokensByUser(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting personal access tokens from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []PersonalAccessToken{}
+	for _, token := range tokens {
+		result = append(result, personalAccessTokenFromDB(token))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerDeletePersonalAccessToken(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	tokenID, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("Error parsing tokenID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	deleted, err := cfg.db.DeletePersonalAccessToken(req.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting personal access token: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if deleted == 0 {
+		writeErrorResponse(writer, req, http.StatusNotFound, "Token not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// middlewareRequireScope lets scoped tokens (personal access tokens and OAuth
+// access tokens) call next when they were granted scope. Requests with a JWT
+// pass straight through, since a login session can do anything its user can.
+// Routes that are not wrapped reject scoped tokens, so account settings and
+// token management need a real login.
+func (cfg *apiConfig) middlewareRequireScope(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := auth.GetBearerToken(r.Header)
+		if err != nil || !isScopedToken(tokenString) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, granted, err := cfg.scopedTokenGrant(r.Context(), tokenString)
+		if err != nil {
+			log.Printf("Error validating scoped token: %s", err)
+			writeErrorResponse(w, r, http.StatusUnauthorized, "Missing or invalid token")
+			return
+		}
+		if !scopes.Has(granted, scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			writeCodedErrorResponse(w, r, http.StatusForbidden, codeInsufficientScope, fmt.Sprintf("Token is missing the %s scope", scope))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopedTokenUserContextKey, userID)))
+	})
+}
+
+func isScopedToken(tokenString string) bool {
+	return auth.IsPersonalAccessToken(tokenString) || oauth.IsAccessToken(tokenString)
+}
+
+// scopedTokenGrant returns the user a scoped token acts for and the scopes it
+// was granted. Tokens of suspended accounts and accounts pending deletion are
+// refused.
+func (cfg *apiConfig) scopedTokenGrant(ctx context.Context, tokenString string) (uuid.UUID, []string, error) {
+	var userID uuid.UUID
+	var granted []string
+	if oauth.IsAccessToken(tokenString) {
+		token, err := cfg.oauthAccessToken(ctx, tokenString)
+		if err != nil {
+			return uuid.UUID{}, nil, err
+		}
+		userID, granted = token.UserID, token.Scopes
+	} else {
+		token, err := cfg.personalAccessToken(ctx, tokenString)
+		if err != nil {
+			return uuid.UUID{}, nil, err
+		}
+		if err := cfg.db.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+			log.Printf("Error updating personal access token: %s", err)
+		}
+		userID, granted = token.UserID, token.Scopes
+	}
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+	if err := accountStatusError(user); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+	return userID, granted, nil
+}
+
+// personalAccessToken looks up an unexpired token by its plaintext value.
+func (cfg *apiConfig) personalAccessToken(ctx context.Context, tokenString string) (database.PersonalAccessToken, error) {
+	token, err := cfg.db.GetPersonalAccessTokenByHash(ctx, auth.HashToken(tokenString))
+	if err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	if token.ExpiresAt.Valid && time.Now().After(token.ExpiresAt.Time) {
+		return database.PersonalAccessToken{}, errPersonalAccessTokenExpired
+	}
+	return token, nil
+}
+
+func personalAccessTokenFromDB(token database.PersonalAccessToken) PersonalAccessToken {
+	result := PersonalAccessToken{
+		ID:        token.ID,
+		CreatedAt: token.CreatedAt,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+	}
+	if token.ExpiresAt.Valid {
+		result.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		result.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return result
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/totp"
+)
+
+// MFAChallenge is returned by handlerLogin instead of a User when the account
+// has two-factor authentication enabled.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TOTPConfirmation is returned when two-factor login is turned on. Every
+// other session is logged out, so it carries new tokens for the caller.
+type TOTPConfirmation struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refresh_token"`
+}
+
+const (
+	mfaChallengeExpiration = 5 * time.Minute
+	recoveryCodeCount      = 10
+	totpIssuer             = "Chirpy"
+)
+
+// handlerEnrollTOTP generates a new secret for the caller. Two-factor login is
+// not enabled until a code from it is sent to handlerConfirmTOTP.
+func (cfg *apiConfig) handlerEnrollTOTP(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		writeErrorResponse(writer, req, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	sealed, err := cfg.totpSecrets.Seal(secret, userID[:])
+	if err != nil {
+		log.Printf("Error encrypting TOTP secret: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := cfg.db.SetTOTPSecret(req.Context(), database.SetTOTPSecretParams{
+		TotpSecret: sql.NullString{String: sealed, Valid: true},
+		ID:         userID,
+	}); err != nil {
+		log.Printf("Error saving TOTP secret: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// handlerConfirmTOTP enables two-factor login once the caller proves their
+// authenticator works, and returns a fresh set of recovery codes. Sessions
+// that logged in with only a password are ended, and the caller gets new
+// tokens.
+func (cfg *apiConfig) handlerConfirmTOTP(writer http.ResponseWriter, req *http.Request) {
+	var requestData confirmTOTPRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		writeErrorResponse(writer, req, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Two-factor enrolment has not been started")
+		return
+	}
+	secret, err := cfg.totpSecrets.Open(user.TotpSecret.String, user.ID[:])
+	if err != nil {
+		log.Printf("Error decrypting TOTP secret: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	step, ok := totp.Validate(requestData.Code, secret, time.Now())
+	if !ok {
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	if err := qtx.EnableTOTP(req.Context(), database.EnableTOTPParams{TotpLastStep: step, ID: userID}); err != nil {
+		log.Printf("Error enabling TOTP: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	codes, err := replaceRecoveryCodes(req.Context(), qtx, userID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := revokeAllTokens(req.Context(), qtx, userID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	user, err = qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	tokens, err := cfg.issueTokens(req, user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, TOTPConfirmation{
+		RecoveryCodes: codes,
+		Token:         tokens.Token,
+		RefreshToken:  tokens.RefreshToken,
+	})
+}
+
+// handlerDisableTOTP turns two-factor login off. The caller must re-enter
+// their password and a current code or an unused recovery code. Every
+// session is ended, and the caller gets new tokens.
+func (cfg *apiConfig) handlerDisableTOTP(writer http.ResponseWriter, req *http.Request) {
+	user, ok := cfg.reauthenticateWithSecondFactor(writer, req)
+	if !ok {
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	if err := qtx.DisableTOTP(req.Context(), user.ID); err != nil {
+		log.Printf("Error disabling TOTP: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodesForUser(req.Context(), user.ID); err != nil {
+		log.Printf("Error deleting recovery codes: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := revokeAllTokens(req.Context(), qtx, user.ID); err != nil {
+		log.Printf("Error revoking tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	user, err = qtx.GetUserByID(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result, err := cfg.issueTokens(req, user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// handlerRegenerateRecoveryCodes replaces all of the caller's recovery codes.
+func (cfg *apiConfig) handlerRegenerateRecoveryCodes(writer http.ResponseWriter, req *http.Request) {
+	user, ok := cfg.reauthenticateWithSecondFactor(writer, req)
+	if !ok {
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	codes, err := replaceRecoveryCodes(req.Context(), cfg.db.WithTx(tx), user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
+
+type loginMFARequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// handlerLoginMFA completes a login started by handlerLogin, exchanging the
+// MFA challenge token and a TOTP or recovery code for access and refresh
+// tokens.
+func (cfg *apiConfig) handlerLoginMFA(writer http.ResponseWriter, req *http.Request) {
+	var requestData loginMFARequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	userID, err := auth.ValidateMFAChallengeToken(requestData.MFAToken, cfg.secret)
+	if err != nil {
+		log.Printf("Error validating MFA challenge token: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	// Wrong codes count towards the same lockout as wrong passwords.
+	accountKey := accountLoginKey(user.Email)
+	if !cfg.checkLoginLockout(writer, req, accountKey) {
+		return
+	}
+	verified, err := cfg.verifySecondFactor(req.Context(), user, requestData.Code, requestData.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if !verified {
+		cfg.rejectLogin(writer, req, accountKey, "Invalid code")
+		return
+	}
+	cfg.clearLoginFailures(req.Context(), accountKey)
+	result, err := cfg.issueTokens(req, user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+type reauthenticationRequest struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// reauthenticateWithSecondFactor authenticates the caller's access token and
+// then checks the password and second factor in the request body.
+func (cfg *apiConfig) reauthenticateWithSecondFactor(writer http.ResponseWriter, req *http.Request) (database.User, bool) {
+	var requestData reauthenticationRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return database.User{}, false
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return database.User{}, false
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return database.User{}, false
+	}
+	if !user.TotpEnabledAt.Valid {
+		writeErrorResponse(writer, req, http.StatusConflict, "Two-factor authentication is not enabled")
+		return database.User{}, false
+	}
+	// Wrong passwords and codes count towards the login lockout.
+	accountKey := accountLoginKey(user.Email)
+	if !cfg.checkLoginLockout(writer, req, accountKey) {
+		return database.User{}, false
+	}
+	if _, err := cfg.passwordHasher.Verify(requestData.Password, user.HashedPassword); err != nil {
+		cfg.rejectLogin(writer, req, accountKey, "Incorrect password")
+		return database.User{}, false
+	}
+	verified, err := cfg.verifySecondFactor(req.Context(), user, requestData.Code, requestData.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return database.User{}, false
+	}
+	if !verified {
+		cfg.rejectLogin(writer, req, accountKey, "Invalid code")
+		return database.User{}, false
+	}
+	cfg.clearLoginFailures(req.Context(), accountKey)
+	return user, true
+}
+
+// verifySecondFactor accepts either a TOTP code or a recovery code. Each is
+// single use: a TOTP step is recorded so the same code cannot be replayed,
+// and a recovery code is marked used.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if !user.TotpEnabledAt.Valid {
+		return false, nil
+	}
+	if code != "" {
+		secret, err := cfg.totpSecrets.Open(user.TotpSecret.String, user.ID[:])
+		if err != nil {
+			return false, err
+		}
+		step, ok := totp.Validate(code, secret, time.Now())
+		if !ok {
+			return false, nil
+		}
+		updated, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{TotpLastStep: step, ID: user.ID})
+		return updated == 1, err
+	}
+	if recoveryCode != "" {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(normalizeRecoveryCode(recoveryCode)),
+			UserID:   user.ID,
+		})
+		return used == 1, err
+	}
+	return false, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores hashes of
+// a new set, returning the codes in plain text to show to the user once.
+func replaceRecoveryCodes(ctx context.Context, qtx *database.Queries, userID uuid.UUID) ([]string, error) {
+	if err := qtx.DeleteRecoveryCodesForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(raw)
+		if err := qtx.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(code),
+			UserID:   userID,
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// newTOTPSecretBox builds the SecretBox that TOTP secrets are stored with from
+// TOTP_ENCRYPTION_KEY, 32 bytes in base64. On the dev platform the key may be
+// left unset, in which case it is derived from secret.
+func newTOTPSecretBox(platform, secret string) (*auth.SecretBox, error) {
+	encoded := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if encoded == "" {
+		if platform != "dev" {
+			return nil, errors.New("TOTP_ENCRYPTION_KEY must be set")
+		}
+		key := sha256.Sum256([]byte("chirpy totp secrets\x00" + secret))
+		return auth.NewSecretBox(key[:])
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP_ENCRYPTION_KEY - %w", err)
+	}
+	return auth.NewSecretBox(key)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/auth"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/mailer"
+)
+
+const emailVerificationTokenExpiration = 24 * time.Hour
+
+var (
+	errInvalidEmail         = errors.New("invalid email address")
+	errEmailNotVerified     = errors.New("email address must be verified before posting")
+	errEmailAlreadyInUse    = errors.New("email address is already in use")
+	errEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// validateEmail accepts a bare address such as "user@example.com". Display
+// names and angle brackets are rejected.
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return errInvalidEmail
+	}
+	return nil
+}
+
+// sendEmailVerification mails a verification token for email, which is
+// either the user's current address or the pending one they are changing to.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTokenExpiration),
+	}); err != nil {
+		return err
+	}
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address for your Chirpy account: %s/app/verify-email?token=%s\n\n"+
+			"The link expires in %s.\n",
+			cfg.publicURL, token, emailVerificationTokenExpiration),
+	}
+	go func() {
+		if err := cfg.mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}()
+	return nil
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// handlerVerifyEmail confirms the address a token was sent to. For a pending
+// email change this is the point at which the new address replaces the old.
+func (cfg *apiConfig) handlerVerifyEmail(writer http.ResponseWriter, req *http.Request) {
+	var requestData verifyEmailRequest
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	verification, err := qtx.UseEmailVerificationToken(req.Context(), auth.HashToken(requestData.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Printf("Error using email verification token: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	user, err := qtx.GetUserByID(req.Context(), verification.UserID)
+	if err != nil {
+		log.Printf("Error getting user from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	// Tokens for an address the user has since moved away from are void.
+	if verification.Email != user.Email && verification.Email != user.PendingEmail.String {
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if verification.Email != user.Email {
+		if _, err := qtx.GetUserByEmail(req.Context(), verification.Email); err == nil {
+			writeErrorResponse(writer, req, http.StatusConflict, errorDetail(errEmailAlreadyInUse))
+			return
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error getting user from DB: %s", err)
+			writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+			return
+		}
+	}
+	user, err = qtx.VerifyEmail(req.Context(), database.VerifyEmailParams{
+		Email: verification.Email,
+		ID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Error verifying email: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, userFromDB(user))
+}
+
+// handlerResendEmailVerification sends a new token to the pending address if
+// there is one, otherwise to the unverified current address.
+func (cfg *apiConfig) handlerResendEmailVerification(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	email := user.PendingEmail.String
+	if email == "" {
+		if user.EmailVerifiedAt.Valid {
+			writeErrorResponse(writer, req, http.StatusConflict, errorDetail(errEmailAlreadyVerified))
+			return
+		}
+		email = user.Email
+	}
+	if err := cfg.sendEmailVerification(req.Context(), user.ID, email); err != nil {
+		log.Printf("Error sending email verification: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// requireVerifiedEmail rejects posting by users with an unverified email when
+// REQUIRE_VERIFIED_EMAIL is enabled.
+func (cfg *apiConfig) requireVerifiedEmail(writer http.ResponseWriter, req *http.Request, user database.User) bool {
+	if cfg.blockUnverifiedPosting && !user.EmailVerifiedAt.Valid {
+		writeErrorResponse(writer, req, http.StatusForbidden, errorDetail(errEmailNotVerified))
+		return false
+	}
+	return true
+}
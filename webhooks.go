@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panaiotuzunov/Chirpy/internal/database"
+	"github.com/panaiotuzunov/Chirpy/internal/webhooks"
+)
+
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Scope     string    `json:"scope"`
+	Active    bool      `json:"active"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// webhookPayload is the JSON body POSTed to receivers.
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+const (
+	webhookScopeUser   = "user"
+	webhookScopeGlobal = "global"
+)
+
+const (
+	webhookDeliveryInterval  = 5 * time.Second
+	webhookDeliveryBatchSize = 20
+	// webhookDeliveryLease keeps a claimed batch from being picked up by
+	// another worker while it is being sent. Sending takes at most one send
+	// timeout per delivery; the extra minute covers the database calls.
+	webhookDeliveryLease   = webhookDeliveryBatchSize*webhooks.SendTimeout + time.Minute
+	maxWebhookDeliveryList = 100
+)
+
+type createWebhookRequest struct {
+	URL    string   `json:"url" validate:"required"`
+	Events []string `json:"events" validate:"required"`
+	Scope  string   `json:"scope"`
+}
+
+func (cfg *apiConfig) handlerCreateWebhook(writer http.ResponseWriter, req *http.Request) {
+	var requestData createWebhookRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	user, ok := cfg.requireActiveAccount(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	if requestData.Scope == "" {
+		requestData.Scope = webhookScopeUser
+	}
+	switch requestData.Scope {
+	case webhookScopeUser:
+	case webhookScopeGlobal:
+		// Global webhooks receive events for every user's chirps.
+		if roleRanks[user.Role] < roleRanks[roleAdmin] {
+			writeErrorResponse(writer, req, http.StatusForbidden, "Only admins can create global webhooks")
+			return
+		}
+	default:
+		writeValidationError(writer, req, invalidField("scope", "Invalid scope"))
+		return
+	}
+	if err := cfg.validateWebhookURL(req.Context(), requestData.URL); err != nil {
+		writeValidationError(writer, req, invalidField("url", errorDetail(err)))
+		return
+	}
+	if err := validateWebhookEvents(requestData.Events); err != nil {
+		writeValidationError(writer, req, invalidField("events", errorDetail(err)))
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	webhook, err := cfg.db.CreateOutboundWebhook(req.Context(), database.CreateOutboundWebhookParams{
+		UserID: userID,
+		Url:    requestData.URL,
+		Secret: secret,
+		Events: requestData.Events,
+		Scope:  requestData.Scope,
+	})
+	if err != nil {
+		log.Printf("Error creating webhook: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := webhookFromDB(webhook)
+	result.Secret = webhook.Secret
+	writeJSONResponse(writer, http.StatusCreated, result)
+}
+
+func (cfg *apiConfig) handlerWebhooks(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	hooks, err := cfg.db.GetOutboundWebhooksByUser(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting webhooks from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []Webhook{}
+	for _, webhook := range hooks {
+		result = append(result, webhookFromDB(webhook))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerGetWebhook(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	webhook, ok := cfg.webhookForOwner(writer, req, userID)
+	if !ok {
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, webhookFromDB(webhook))
+}
+
+type updateWebhookRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+func (cfg *apiConfig) handlerUpdateWebhook(writer http.ResponseWriter, req *http.Request) {
+	var requestData updateWebhookRequest
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	webhook, ok := cfg.webhookForOwner(writer, req, userID)
+	if !ok {
+		return
+	}
+	if !decodeRequest(writer, req, &requestData) {
+		return
+	}
+	params := database.UpdateOutboundWebhookParams{
+		Url:    webhook.Url,
+		Events: webhook.Events,
+		Active: webhook.Active,
+		ID:     webhook.ID,
+	}
+	if requestData.URL != nil {
+		if err := cfg.validateWebhookURL(req.Context(), *requestData.URL); err != nil {
+			writeValidationError(writer, req, invalidField("url", errorDetail(err)))
+			return
+		}
+		params.Url = *requestData.URL
+	}
+	if requestData.Events != nil {
+		if err := validateWebhookEvents(requestData.Events); err != nil {
+			writeValidationError(writer, req, invalidField("events", errorDetail(err)))
+			return
+		}
+		params.Events = requestData.Events
+	}
+	if requestData.Active != nil {
+		params.Active = *requestData.Active
+	}
+	webhook, err = cfg.db.UpdateOutboundWebhook(req.Context(), params)
+	if err != nil {
+		log.Printf("Error updating webhook: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, webhookFromDB(webhook))
+}
+
+func (cfg *apiConfig) handlerDeleteWebhook(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	webhook, ok := cfg.webhookForOwner(writer, req, userID)
+	if !ok {
+		return
+	}
+	if err := cfg.db.DeleteOutboundWebhook(req.Context(), webhook.ID); err != nil {
+		log.Printf("Error deleting webhook: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerWebhookDeliveries(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	webhook, ok := cfg.webhookForOwner(writer, req, userID)
+	if !ok {
+		return
+	}
+	deliveries, err := cfg.db.GetOutboundWebhookDeliveries(req.Context(), database.GetOutboundWebhookDeliveriesParams{
+		WebhookID: webhook.ID,
+		Limit:     maxWebhookDeliveryList,
+	})
+	if err != nil {
+		log.Printf("Error getting webhook deliveries from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	result := []WebhookDelivery{}
+	for _, delivery := range deliveries {
+		result = append(result, webhookDeliveryFromDB(delivery))
+	}
+	writeJSONResponse(writer, http.StatusOK, result)
+}
+
+// handlerRedeliverWebhook puts a delivery back in the queue with a fresh set
+// of attempts, which is how dead-lettered deliveries are retried by hand.
+func (cfg *apiConfig) handlerRedeliverWebhook(writer http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		writeErrorResponse(writer, req, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	webhook, ok := cfg.webhookForOwner(writer, req, userID)
+	if !ok {
+		return
+	}
+	deliveryID, err := uuid.Parse(req.PathValue("deliveryID"))
+	if err != nil {
+		log.Printf("Error parsing deliveryID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	delivery, err := cfg.db.RetryOutboundWebhookDelivery(req.Context(), database.RetryOutboundWebhookDeliveryParams{
+		ID:        deliveryID,
+		WebhookID: webhook.ID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+			return
+		}
+		log.Printf("Error requeueing webhook delivery: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return
+	}
+	writeJSONResponse(writer, http.StatusAccepted, webhookDeliveryFromDB(delivery))
+}
+
+// enqueueWebhookEvent queues a delivery of event to every active webhook
+// owned by ownerID or registered globally. Failures are logged rather than
+// returned so that a broken integration never fails the request that
+// triggered it.
+func (cfg *apiConfig) enqueueWebhookEvent(ctx context.Context, ownerID uuid.UUID, event string, data any) {
+	hooks, err := cfg.db.GetOutboundWebhooksForEvent(ctx, database.GetOutboundWebhooksForEventParams{
+		Event:   event,
+		OwnerID: ownerID,
+	})
+	if err != nil {
+		log.Printf("Error getting webhooks for %s: %s", event, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(webhookPayload{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Error marshaling %s payload: %s", event, err)
+		return
+	}
+	for _, webhook := range hooks {
+		if _, err := cfg.db.CreateOutboundWebhookDelivery(ctx, database.CreateOutboundWebhookDeliveryParams{
+			WebhookID: webhook.ID,
+			Event:     event,
+			Payload:   payload,
+		}); err != nil {
+			log.Printf("Error queueing %s for webhook %s: %s", event, webhook.ID, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) deliverWebhooks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := cfg.announceScheduledChirps(context.Background()); err != nil {
+			log.Printf("Error announcing scheduled chirps: %s", err)
+		}
+		if err := cfg.processWebhookDeliveries(context.Background(), time.Now()); err != nil {
+			log.Printf("Error delivering webhooks: %s", err)
+		}
+	}
+}
+
+// announceScheduledChirps queues chirp.created for scheduled chirps whose
+// publish time has passed. Each chirp is marked as announced by the same
+// statement that claims it, so it is announced once even with several
+// workers.
+func (cfg *apiConfig) announceScheduledChirps(ctx context.Context) error {
+	chirps, err := cfg.db.AnnounceDueScheduledChirps(ctx)
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		cfg.enqueueWebhookEvent(ctx, chirp.UserID, webhooks.EventChirpCreated, chirpFromDB(chirp))
+	}
+	return nil
+}
+
+// processWebhookDeliveries sends every due delivery once and records the
+// outcome, scheduling a retry with backoff or dead-lettering it.
+func (cfg *apiConfig) processWebhookDeliveries(ctx context.Context, now time.Time) error {
+	deliveries, err := cfg.db.ClaimDueOutboundWebhookDeliveries(ctx, database.ClaimDueOutboundWebhookDeliveriesParams{
+		LeaseUntil: now.Add(webhookDeliveryLease),
+		BatchSize:  webhookDeliveryBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		params := database.RecordOutboundWebhookAttemptParams{ID: delivery.ID}
+		delivered := false
+		webhook, err := cfg.db.GetOutboundWebhookByID(ctx, delivery.WebhookID)
+		switch {
+		case err != nil:
+			params.LastError = err.Error()
+		case !webhook.Active:
+			params.LastError = "webhook is inactive"
+		default:
+			status, err := cfg.webhookSender.Send(ctx, webhook.Url, webhook.Secret, delivery.ID.String(), delivery.Event, delivery.Payload)
+			if err != nil {
+				params.LastError = err.Error()
+			} else {
+				params.LastStatusCode = sql.NullInt32{Int32: int32(status), Valid: true}
+				delivered = webhooks.Succeeded(status)
+				if !delivered {
+					params.LastError = fmt.Sprintf("receiver responded with status %d", status)
+				}
+			}
+		}
+		attemptedAt := time.Now()
+		outcome := webhooks.Next(int(delivery.Attempts)+1, delivered, attemptedAt)
+		params.Status = outcome.Status
+		params.NextAttemptAt = outcome.NextAttemptAt
+		if delivered {
+			params.DeliveredAt = sql.NullTime{Time: attemptedAt, Valid: true}
+		}
+		if _, err := cfg.db.RecordOutboundWebhookAttempt(ctx, params); err != nil {
+			log.Printf("Error recording attempt for webhook delivery %s: %s", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// webhookForOwner loads the webhook named in the path, answering 404 when it
+// does not exist or belongs to someone else.
+func (cfg *apiConfig) webhookForOwner(writer http.ResponseWriter, req *http.Request, userID uuid.UUID) (database.OutboundWebhook, bool) {
+	webhookID, err := uuid.Parse(req.PathValue("webhookID"))
+	if err != nil {
+		log.Printf("Error parsing webhookID argument: %s", err)
+		writeErrorResponse(writer, req, http.StatusBadRequest, "Invalid ID")
+		return database.OutboundWebhook{}, false
+	}
+	webhook, err := cfg.db.GetOutboundWebhookByID(req.Context(), webhookID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+			return database.OutboundWebhook{}, false
+		}
+		log.Printf("Error getting webhook from DB: %s", err)
+		writeErrorResponse(writer, req, http.StatusInternalServerError, internalErrorMessage)
+		return database.OutboundWebhook{}, false
+	}
+	if webhook.UserID != userID {
+		writeErrorResponse(writer, req, http.StatusNotFound, "Not found")
+		return database.OutboundWebhook{}, false
+	}
+	return webhook, true
+}
+
+var (
+	errWebhookURLInvalid  = errors.New("invalid URL")
+	errWebhookURLInsecure = errors.New("URL must use https")
+	errWebhookURLPrivate  = errors.New("URL must point to a public address")
+	errWebhookURLResolve  = errors.New("URL host could not be resolved")
+	errWebhookNoEvents    = errors.New("at least one event is required")
+)
+
+// validateWebhookURL requires HTTPS callback URLs on public addresses. Plain
+// HTTP and private addresses are accepted on the dev platform so that local
+// receivers can be used.
+func (cfg *apiConfig) validateWebhookURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return errWebhookURLInvalid
+	}
+	if cfg.platform == "dev" {
+		if parsed.Scheme != "https" && parsed.Scheme != "http" {
+			return errWebhookURLInsecure
+		}
+		return nil
+	}
+	if parsed.Scheme != "https" {
+		return errWebhookURLInsecure
+	}
+	if err := webhooks.CheckHost(ctx, parsed.Hostname()); err != nil {
+		if errors.Is(err, webhooks.ErrPrivateAddress) {
+			return errWebhookURLPrivate
+		}
+		log.Printf("Error checking webhook host: %s", err)
+		return errWebhookURLResolve
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return errWebhookNoEvents
+	}
+	for _, event := range events {
+		if !webhooks.Events[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func webhookFromDB(webhook database.OutboundWebhook) Webhook {
+	return Webhook{
+		ID:        webhook.ID,
+		CreatedAt: webhook.CreatedAt,
+		UpdatedAt: webhook.UpdatedAt,
+		UserID:    webhook.UserID,
+		URL:       webhook.Url,
+		Events:    webhook.Events,
+		Scope:     webhook.Scope,
+		Active:    webhook.Active,
+	}
+}
+
+func webhookDeliveryFromDB(delivery database.OutboundWebhookDelivery) WebhookDelivery {
+	result := WebhookDelivery{
+		ID:        delivery.ID,
+		CreatedAt: delivery.CreatedAt,
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError,
+	}
+	if delivery.Status == webhooks.StatusPending {
+		result.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastStatusCode.Valid {
+		result.LastStatusCode = &delivery.LastStatusCode.Int32
+	}
+	if delivery.DeliveredAt.Valid {
+		result.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	return result
+}